@@ -2,6 +2,10 @@ package failure_detector
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
 	"time"
 
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -11,30 +15,142 @@ import (
 // processFunc a function that processes a batch of EndpointSamples
 type processFunc func(objs []*EndpointSample)
 
+// OverflowStrategy describes what happens to an EndpointSample recorded while the collector channel is full
+type OverflowStrategy string
+
+const (
+	// OverflowDropNewest discards the sample being recorded
+	OverflowDropNewest OverflowStrategy = "DropNewest"
+
+	// OverflowDropOldest discards the oldest sample waiting in the collector channel to make room for the sample being recorded
+	OverflowDropOldest OverflowStrategy = "DropOldest"
+
+	// OverflowSample admits only OverflowPolicy.Fraction of the samples recorded while the channel is full (by discarding the oldest ones),
+	// the rest are discarded, this keeps the content of the channel representative of the most recent traffic
+	OverflowSample OverflowStrategy = "Sample"
+)
+
+// OverflowPolicy configures the behaviour of Record when the collector channel is full
+type OverflowPolicy struct {
+	Strategy OverflowStrategy
+
+	// Fraction is a number in the [0, 1] range, it is only used by the OverflowSample strategy
+	Fraction float64
+}
+
+// DefaultOverflowPolicy is used when no other policy has been configured or the configured policy is invalid
+var DefaultOverflowPolicy = OverflowPolicy{Strategy: OverflowDropNewest}
+
+// Validate checks that the strategy is one of the supported ones and the fraction is in the [0, 1] range
+func (p OverflowPolicy) Validate() error {
+	switch p.Strategy {
+	case OverflowDropNewest, OverflowDropOldest, OverflowSample:
+	default:
+		return fmt.Errorf("unsupported overflow strategy %q, expected %s, %s or %s", p.Strategy, OverflowDropNewest, OverflowDropOldest, OverflowSample)
+	}
+	if math.IsNaN(p.Fraction) || p.Fraction < 0 || p.Fraction > 1 {
+		return fmt.Errorf("invalid overflow fraction %v, must be in the [0, 1] range", p.Fraction)
+	}
+	return nil
+}
+
 // processor retrieves EndpointSamples from the exposed channel and calls out to processFunc for processing
 type processor struct {
+	// droppedSamples counts samples discarded by record, must be accessed atomically
+	// it is kept first so that it is 64-bit aligned on 32-bit platforms
+	droppedSamples uint64
+
 	batchKeyFn KeyFunc
-	queue      endPointSampleBatchQueue
+	queue      *endPointSampleBatchQueue
 	processFn  processFunc
-	collectCh  chan *EndpointSample
+
+	// collectCh holds EndpointSamples passed to record, they have already been validated by the caller
+	collectCh chan *EndpointSample
+
+	// uncheckedCh is exposed to producers (see failureDetector.Collector), EndpointSamples sent to it are validated by admitFn
+	uncheckedCh chan *EndpointSample
+
+	// overflowPolicy is applied by record when collectCh is full
+	overflowPolicy OverflowPolicy
+
+	// randFloat64 returns a pseudo-random number in [0, 1), used by the OverflowSample strategy
+	randFloat64 func() float64
+
+	// admitFn an optional function that validates EndpointSamples taken off uncheckedCh, rejected samples are discarded
+	admitFn func(endpointSample *EndpointSample) bool
+
+	// tapFn an optional function that observes every admitted EndpointSample taken off the collector channels
+	tapFn func(endpointSample *EndpointSample)
 }
 
 // newProcessor creates a processor that adds EndpointSamples to the given queue under a key derived from the given batchKeyFn function and calls out to the given processFn function for processing
-func newProcessor(batchKeyFn KeyFunc, processFn processFunc, queue endPointSampleBatchQueue) *processor {
+func newProcessor(batchKeyFn KeyFunc, processFn processFunc, queue *endPointSampleBatchQueue) *processor {
 	return &processor{
-		batchKeyFn: batchKeyFn,
-		queue:      queue,
-		processFn:  processFn,
-		collectCh:  make(chan *EndpointSample, 1000),
+		batchKeyFn:  batchKeyFn,
+		queue:       queue,
+		processFn:   processFn,
+		collectCh:   make(chan *EndpointSample, defaultChannelCapacity),
+		uncheckedCh: make(chan *EndpointSample, defaultChannelCapacity),
+
+		overflowPolicy: DefaultOverflowPolicy,
+		randFloat64:    rand.Float64,
 	}
 }
 
+// record adds the given EndpointSample to the collector channel without blocking
+// when the channel is full the configured overflow policy is applied
+// it returns true if the sample has been accepted
+func (p *processor) record(endpointSample *EndpointSample) bool {
+	select {
+	case p.collectCh <- endpointSample:
+		return true
+	default:
+	}
+
+	switch p.overflowPolicy.Strategy {
+	case OverflowDropOldest:
+		return p.replaceOldest(endpointSample)
+	case OverflowSample:
+		if p.randFloat64() < p.overflowPolicy.Fraction {
+			return p.replaceOldest(endpointSample)
+		}
+	}
+
+	atomic.AddUint64(&p.droppedSamples, 1)
+	return false
+}
+
+// replaceOldest discards the oldest sample from the collector channel and adds the given one in its place
+// since the channel is shared with other producers it gives up after a few attempts and discards the given sample instead
+func (p *processor) replaceOldest(endpointSample *EndpointSample) bool {
+	for attempt := 0; attempt < 3; attempt++ {
+		select {
+		case <-p.collectCh:
+			atomic.AddUint64(&p.droppedSamples, 1)
+		default:
+		}
+
+		select {
+		case p.collectCh <- endpointSample:
+			return true
+		default:
+		}
+	}
+
+	atomic.AddUint64(&p.droppedSamples, 1)
+	return false
+}
+
+// dropped returns the number of samples discarded by record so far
+func (p *processor) dropped() uint64 {
+	return atomic.LoadUint64(&p.droppedSamples)
+}
+
 // run starts the processor that
 //  - runs one worker for collecting EndpointSamples from the exposed channel and adding them to the queue
 //  - runs the given number of workers that takes the collected data off the queue and calls out to the defined processFunc
 func (p *processor) run(ctx context.Context, workers int) {
-	// TODO: shutdown the queue
-	// defer p.queue.Shutdown()
+	defer p.queue.ShutDown()
 
 	for i := 0; i < workers; i++ {
 		go wait.Until(p.worker, time.Second, ctx.Done())
@@ -52,7 +168,10 @@ func (p *processor) worker() {
 }
 
 func (p *processor) processNextWorkItem() bool {
-	key, items := p.queue.Get()
+	key, items, shutdown := p.queue.Get()
+	if shutdown {
+		return false
+	}
 	defer p.queue.Done(key)
 
 	// sync
@@ -61,6 +180,52 @@ func (p *processor) processNextWorkItem() bool {
 	return true
 }
 
+// processPending takes all EndpointSamples off the collector channels, groups them by the batch key
+// and calls out to the defined processFunc for every batch in the order in which the batches were created
+func (p *processor) processPending() {
+	batchKeys := []string{}
+	batches := map[string][]*EndpointSample{}
+	for {
+		endpointSample, ok := p.nextPending()
+		if !ok {
+			for _, batchKey := range batchKeys {
+				p.processFn(batches[batchKey])
+			}
+			return
+		}
+		if p.tapFn != nil {
+			p.tapFn(endpointSample)
+		}
+		batchKey := p.batchKeyFn(endpointSample)
+		if _, ok := batches[batchKey]; !ok {
+			batchKeys = append(batchKeys, batchKey)
+		}
+		batches[batchKey] = append(batches[batchKey], endpointSample)
+	}
+}
+
+// nextPending takes the next admitted EndpointSample off the collector channels without blocking,
+// samples passed to record go first, the second value is false when both channels are empty
+func (p *processor) nextPending() (*EndpointSample, bool) {
+	for {
+		select {
+		case endpointSample := <-p.collectCh:
+			return endpointSample, true
+		default:
+		}
+
+		select {
+		case endpointSample := <-p.uncheckedCh:
+			if p.admitFn != nil && !p.admitFn(endpointSample) {
+				continue
+			}
+			return endpointSample, true
+		default:
+			return nil, false
+		}
+	}
+}
+
 // collector adds collected EndpointSamples to the internal queue for processing
 func (p *processor) collector(ctx context.Context) func() {
 	return func() {
@@ -70,8 +235,21 @@ func (p *processor) collector(ctx context.Context) func() {
 			case <-ctx.Done():
 				return
 			case endpointSample := <-p.collectCh:
-				p.queue.Add(p.batchKeyFn(endpointSample), endpointSample)
+				p.enqueue(endpointSample)
+			case endpointSample := <-p.uncheckedCh:
+				if p.admitFn != nil && !p.admitFn(endpointSample) {
+					continue
+				}
+				p.enqueue(endpointSample)
 			}
 		}
 	}
 }
+
+// enqueue adds the given admitted EndpointSample to the internal queue
+func (p *processor) enqueue(endpointSample *EndpointSample) {
+	if p.tapFn != nil {
+		p.tapFn(endpointSample)
+	}
+	p.queue.Add(p.batchKeyFn(endpointSample), endpointSample)
+}
@@ -0,0 +1,139 @@
+package failure_detector
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestProcessorRecord(t *testing.T) {
+	scenarios := []struct {
+		name             string
+		policy           OverflowPolicy
+		randValues       []float64
+		capacity         int
+		samplesToRecord  int
+		expectedAccepted int
+		expectedDropped  uint64
+		expectedContent  []string
+	}{
+		{
+			name:             "the channel is not full - all samples accepted",
+			policy:           DefaultOverflowPolicy,
+			capacity:         3,
+			samplesToRecord:  3,
+			expectedAccepted: 3,
+			expectedContent:  []string{"0", "1", "2"},
+		},
+		{
+			name:             "drop newest keeps the oldest samples",
+			policy:           OverflowPolicy{Strategy: OverflowDropNewest},
+			capacity:         3,
+			samplesToRecord:  5,
+			expectedAccepted: 3,
+			expectedDropped:  2,
+			expectedContent:  []string{"0", "1", "2"},
+		},
+		{
+			name:             "drop oldest keeps the newest samples",
+			policy:           OverflowPolicy{Strategy: OverflowDropOldest},
+			capacity:         3,
+			samplesToRecord:  5,
+			expectedAccepted: 5,
+			expectedDropped:  2,
+			expectedContent:  []string{"2", "3", "4"},
+		},
+		{
+			name:             "sample admits only a fraction of samples",
+			policy:           OverflowPolicy{Strategy: OverflowSample, Fraction: 0.5},
+			randValues:       []float64{0.1, 0.9, 0.4, 0.6},
+			capacity:         2,
+			samplesToRecord:  6,
+			expectedAccepted: 4,
+			expectedDropped:  4,
+			expectedContent:  []string{"2", "4"},
+		},
+		{
+			name:             "sample with fraction 0 behaves like drop newest",
+			policy:           OverflowPolicy{Strategy: OverflowSample},
+			randValues:       []float64{0, 0},
+			capacity:         2,
+			samplesToRecord:  4,
+			expectedAccepted: 2,
+			expectedDropped:  2,
+			expectedContent:  []string{"0", "1"},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := newProcessor(EndpointSampleToServiceKeyFunction, nil, nil)
+			target.collectCh = make(chan *EndpointSample, scenario.capacity)
+			target.overflowPolicy = scenario.policy
+			target.randFloat64 = func() float64 {
+				ret := scenario.randValues[0]
+				scenario.randValues = scenario.randValues[1:]
+				return ret
+			}
+
+			accepted := 0
+			for i := 0; i < scenario.samplesToRecord; i++ {
+				if target.record(&EndpointSample{Namespace: "ns", Service: fmt.Sprintf("%d", i)}) {
+					accepted++
+				}
+			}
+			close(target.collectCh)
+
+			actualContent := []string{}
+			for endpointSample := range target.collectCh {
+				actualContent = append(actualContent, endpointSample.Service)
+			}
+
+			if accepted != scenario.expectedAccepted {
+				t.Fatalf("expected %d accepted samples but got %d", scenario.expectedAccepted, accepted)
+			}
+			if target.dropped() != scenario.expectedDropped {
+				t.Fatalf("expected %d dropped samples but got %d", scenario.expectedDropped, target.dropped())
+			}
+			if !reflect.DeepEqual(actualContent, scenario.expectedContent) {
+				t.Fatalf("expected %v in the channel but got %v", scenario.expectedContent, actualContent)
+			}
+		})
+	}
+}
+
+func TestOverflowPolicyValidate(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		policy        OverflowPolicy
+		expectedValid bool
+	}{
+		{name: "default", policy: DefaultOverflowPolicy, expectedValid: true},
+		{name: "sample", policy: OverflowPolicy{Strategy: OverflowSample, Fraction: 0.5}, expectedValid: true},
+		{name: "empty strategy", policy: OverflowPolicy{}},
+		{name: "unknown strategy", policy: OverflowPolicy{Strategy: "DropRandom"}},
+		{name: "negative fraction", policy: OverflowPolicy{Strategy: OverflowSample, Fraction: -0.1}},
+		{name: "fraction above 1", policy: OverflowPolicy{Strategy: OverflowSample, Fraction: 1.5}},
+		{name: "NaN fraction", policy: OverflowPolicy{Strategy: OverflowSample, Fraction: math.NaN()}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			err := scenario.policy.Validate()
+			if valid := err == nil; valid != scenario.expectedValid {
+				t.Fatalf("expected the policy to be valid: %v, got %v", scenario.expectedValid, err)
+			}
+
+			// an invalid policy is replaced with the default one
+			expectedPolicy := scenario.policy
+			if !scenario.expectedValid {
+				expectedPolicy = DefaultOverflowPolicy
+			}
+			target := NewDefaultFailureDetector(WithOverflowPolicy(scenario.policy))
+			if actualPolicy := target.processor.overflowPolicy; actualPolicy != expectedPolicy {
+				t.Fatalf("expected %+v overflow policy but got %+v", expectedPolicy, actualPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package failure_detector
+
+import "sync"
+
+// BatchQueue a work queue that processes items in the order in which they were added,
+// it also supports batching - items are grouped by a key and are retrieved as a package.
+// A key is never processed by more than one worker at a time, items added while the key is being processed
+// are retrieved as the next batch once the current one is done.
+//
+// It is safe for concurrent use
+type BatchQueue[K comparable, V any] struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	// queue holds keys that have items waiting and aren't being processed, in the order in which they were added
+	queue []K
+
+	// items holds the items waiting per key
+	items map[K][]V
+
+	// processing holds the keys that have been retrieved by Get and haven't been marked as Done
+	processing map[K]struct{}
+
+	shuttingDown bool
+}
+
+// NewBatchQueue creates a new, empty batch queue
+func NewBatchQueue[K comparable, V any]() *BatchQueue[K, V] {
+	q := &BatchQueue[K, V]{
+		items:      map[K][]V{},
+		processing: map[K]struct{}{},
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// Add adds the given item under the given key to the queue, items added after ShutDown are discarded
+func (q *BatchQueue[K, V]) Add(key K, item V) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.shuttingDown {
+		return
+	}
+
+	_, waiting := q.items[key]
+	q.items[key] = append(q.items[key], item)
+	if _, processing := q.processing[key]; !waiting && !processing {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+// Get blocks until the next batch of items is available and retrieves it along with the unique key.
+// A caller must execute the corresponding Done() method once it has finished its work.
+// The last value is true once the queue has been shut down, the caller should stop then
+func (q *BatchQueue[K, V]) Get() (key K, items []V, shutdown bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.queue) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return key, nil, true
+	}
+
+	key = q.queue[0]
+	var zero K
+	q.queue[0] = zero
+	q.queue = q.queue[1:]
+	items = q.items[key]
+	delete(q.items, key)
+	q.processing[key] = struct{}{}
+	return key, items, false
+}
+
+// Done indicates that the caller finished working on items represented by a unique key
+// if it has been added again while it was being processed, it will be re-added to the queue for re-processing
+func (q *BatchQueue[K, V]) Done(key K) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.processing, key)
+	if _, waiting := q.items[key]; waiting {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+// Len returns the number of keys waiting for processing
+func (q *BatchQueue[K, V]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.queue)
+}
+
+// ShutDown makes the queue ignore new items and unblocks workers waiting in Get once the queue has been drained
+func (q *BatchQueue[K, V]) ShutDown() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
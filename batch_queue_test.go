@@ -0,0 +1,101 @@
+package failure_detector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestBatchQueue(t *testing.T) {
+	type batch struct {
+		key   string
+		items []int
+	}
+	type item struct {
+		key   string
+		value int
+	}
+	scenarios := []struct {
+		name            string
+		add             []item
+		processing      []string
+		addAfterGet     []item
+		expectedBatches []batch
+	}{
+		{
+			name:            "items are grouped by key in the order in which the keys were added",
+			add:             []item{{"b", 1}, {"a", 2}, {"b", 3}, {"c", 4}, {"a", 5}},
+			expectedBatches: []batch{{"b", []int{1, 3}}, {"a", []int{2, 5}}, {"c", []int{4}}},
+		},
+		{
+			name:            "items added while a key is being processed are retrieved once it is done",
+			add:             []item{{"a", 1}},
+			processing:      []string{"a"},
+			addAfterGet:     []item{{"a", 2}, {"b", 3}, {"a", 4}},
+			expectedBatches: []batch{{"b", []int{3}}, {"a", []int{2, 4}}},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewBatchQueue[string, int]()
+			for _, i := range scenario.add {
+				target.Add(i.key, i.value)
+			}
+			for _, expectedKey := range scenario.processing {
+				if key, _, _ := target.Get(); key != expectedKey {
+					t.Fatalf("expected %q key but got %q", expectedKey, key)
+				}
+			}
+			for _, i := range scenario.addAfterGet {
+				target.Add(i.key, i.value)
+			}
+			for _, key := range scenario.processing {
+				target.Done(key)
+			}
+
+			actualBatches := []batch{}
+			for target.Len() > 0 {
+				key, items, shutdown := target.Get()
+				if shutdown {
+					t.Fatal("unexpected shutdown")
+				}
+				actualBatches = append(actualBatches, batch{key, items})
+				target.Done(key)
+			}
+			if !reflect.DeepEqual(actualBatches, scenario.expectedBatches) {
+				t.Fatalf("expected %v batches but got %v", scenario.expectedBatches, actualBatches)
+			}
+		})
+	}
+}
+
+func TestBatchQueueShutDown(t *testing.T) {
+	target := NewBatchQueue[string, int]()
+	target.Add("a", 1)
+
+	result := make(chan bool)
+	go func() {
+		for {
+			key, _, shutdown := target.Get()
+			if shutdown {
+				result <- true
+				return
+			}
+			target.Done(key)
+		}
+	}()
+
+	target.ShutDown()
+	target.Add("b", 2)
+	select {
+	case <-result:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("expected the worker to be unblocked by ShutDown")
+	}
+	if target.Len() != 0 {
+		t.Fatalf("expected items added after ShutDown to be discarded, got %d keys", target.Len())
+	}
+}
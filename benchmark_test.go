@@ -0,0 +1,160 @@
+package failure_detector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func BenchmarkCollectorSend(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	target := NewDefaultFailureDetector()
+	go target.Run(ctx)
+	samples := benchmarkSamples(1, 10, 1000)
+	collectorCh := target.Collector()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		collectorCh <- samples[i%len(samples)]
+	}
+}
+
+func BenchmarkRecord(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	target := NewDefaultFailureDetector()
+	go target.Run(ctx)
+	samples := benchmarkSamples(1, 10, 1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			target.Record(samples[i%len(samples)])
+			i++
+		}
+	})
+}
+
+func BenchmarkBatchQueue(b *testing.B) {
+	for _, keys := range []int{1, 100} {
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			queue := NewBatchQueue[string, *EndpointSample]()
+			samples := benchmarkSamples(keys, 1, keys)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				endpointSample := samples[i%len(samples)]
+				queue.Add(EndpointSampleToServiceKeyFunction(endpointSample), endpointSample)
+				key, _, _ := queue.Get()
+				queue.Done(key)
+			}
+		})
+	}
+}
+
+func BenchmarkProcessBatch(b *testing.B) {
+	for _, batchSize := range []int{1, 10, 100, 1000} {
+		for _, endpoints := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("batch=%d/endpoints=%d", batchSize, endpoints), func(b *testing.B) {
+				target := NewDefaultFailureDetector()
+				batch := benchmarkSamples(1, endpoints, batchSize)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					target.processBatch(batch)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPropagateChangesToReadOnlyStore(b *testing.B) {
+	for _, services := range []int{10, 1000, 5000} {
+		b.Run(fmt.Sprintf("services=%d", services), func(b *testing.B) {
+			target := benchmarkDetector(benchmarkSamples(services, 5, services*5))
+			changedService := serviceName{namespace: "ns-0", service: "svc-0"}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				target.propagateChangesToReadOnlyStore(changedService)
+			}
+		})
+	}
+}
+
+func BenchmarkEndpointStatus(b *testing.B) {
+	samples := benchmarkSamples(1000, 5, 5000)
+	target := benchmarkDetector(samples)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			endpointSample := samples[i%len(samples)]
+			target.EndpointStatus(endpointSample.Namespace, endpointSample.Service, endpointSample.URL)
+			i++
+		}
+	})
+}
+
+func BenchmarkServiceViewEndpointStatus(b *testing.B) {
+	samples := benchmarkSamples(1000, 5, 5000)
+	target := benchmarkDetector(samples)
+	views := make([]ServiceView, len(samples))
+	for i, endpointSample := range samples {
+		views[i] = target.Lookup(endpointSample.Namespace, endpointSample.Service)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			views[i%len(views)].EndpointStatus(samples[i%len(samples)].URL)
+			i++
+		}
+	})
+}
+
+// benchmarkDetector returns a detector that has processed the given samples and published all Services,
+// samples that don't change the status of an endpoint aren't published by processBatch
+func benchmarkDetector(samples []*EndpointSample) *failureDetector {
+	target := NewDefaultFailureDetector()
+	for _, endpointSample := range samples {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	target.lock.Lock()
+	defer target.lock.Unlock()
+	target.propagateChangesToReadOnlyStore(target.store.Keys()...)
+	return target
+}
+
+// benchmarkSamples generates the given number of samples spread evenly across the given number of Services and endpoints per Service,
+// every other sample carries an error
+func benchmarkSamples(services, endpointsPerService, number int) []*EndpointSample {
+	samples := make([]*EndpointSample, number)
+	for i := 0; i < number; i++ {
+		var err error
+		if i%2 == 0 {
+			err = fmt.Errorf("nasty error")
+		}
+		service := i % services
+		endpoint := (i / services) % endpointsPerService
+		samples[i] = &EndpointSample{
+			Namespace: fmt.Sprintf("ns-%d", service%10),
+			Service:   fmt.Sprintf("svc-%d", service),
+			URL:       &url.URL{Scheme: "https", Host: fmt.Sprintf("10.0.%d.%d:6443", service%256, endpoint)},
+			Err:       err,
+		}
+	}
+	return samples
+}
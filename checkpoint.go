@@ -0,0 +1,310 @@
+package failure_detector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// checkpointVersion is the version of the checkpoint format, it must be bumped on incompatible changes
+const checkpointVersion = 1
+
+// checkpointHeader is the first line of a checkpoint file
+type checkpointHeader struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// checkpointEndpoint is a single line of a checkpoint file that holds the state of an endpoint.
+// Each endpoint is stored in a separate line so that a partially written file still yields the entries written before the corruption
+type checkpointEndpoint struct {
+	Namespace  string             `json:"namespace"`
+	Service    string             `json:"service"`
+	URL        string             `json:"url"`
+	Key        string             `json:"key,omitempty"`
+	Reason     string             `json:"reason,omitempty"`
+	Weight     float32            `json:"weight"`
+	LastUpdate time.Time          `json:"lastUpdate"`
+	Samples    []checkpointSample `json:"samples,omitempty"`
+
+	// LastTransition, DecisionReason, Message, DecisionSamples and DecisionErrors describe the last decision, see EndpointStatusDetails
+	LastTransition  *time.Time `json:"lastTransition,omitempty"`
+	DecisionReason  string     `json:"decisionReason,omitempty"`
+	Message         string     `json:"message,omitempty"`
+	DecisionSamples int        `json:"decisionSamples,omitempty"`
+	DecisionErrors  int        `json:"decisionErrors,omitempty"`
+
+	History []StatusTransition `json:"history,omitempty"`
+}
+
+// checkpointSample holds a single Sample, the original error can't be restored, only its message is kept
+type checkpointSample struct {
+	Err     string        `json:"err,omitempty"`
+	Failed  bool          `json:"failed,omitempty"`
+	Active  bool          `json:"active,omitempty"`
+	Count   float64       `json:"count,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Time    *time.Time    `json:"time,omitempty"`
+}
+
+// checkpointer holds the configuration of checkpointing
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	maxAge   time.Duration
+}
+
+// run periodically calls the given function until the context is done, the function is called one last time on shutdown
+func (c *checkpointer) run(ctx context.Context, checkpointFn func()) {
+	wait.Until(checkpointFn, c.interval, ctx.Done())
+	checkpointFn()
+}
+
+// writeCheckpoint persists the current state of the store to the configured file
+func (fd *failureDetector) writeCheckpoint() {
+	fd.lock.Lock()
+	endpoints := []*WeightedEndpointStatus{}
+	for _, epStore := range fd.store.List() {
+		endpoints = append(endpoints, epStore.List()...)
+	}
+	now := fd.clock.Now()
+	entries := toCheckpointEndpoints(endpoints)
+	fd.lock.Unlock()
+
+	if err := writeCheckpointFile(fd.checkpointer.path, now, entries); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to write checkpoint %q: %v", fd.checkpointer.path, err))
+	}
+}
+
+// restoreCheckpoint loads the configured file into the store, a missing or corrupted file is not fatal
+func (fd *failureDetector) restoreCheckpoint() {
+	f, err := os.Open(fd.checkpointer.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to open checkpoint %q: %v", fd.checkpointer.path, err))
+		return
+	}
+	defer f.Close()
+
+	endpoints, err := readCheckpoint(f, fd.clock.Now(), fd.checkpointer.maxAge, fd.newEndpoint)
+	if err != nil {
+		// keep whatever has been read so far
+		utilruntime.HandleError(fmt.Errorf("failed to read checkpoint %q, restored %d endpoints: %v", fd.checkpointer.path, len(endpoints), err))
+	}
+	fd.restoreEndpoints(endpoints)
+}
+
+// restoreEndpoints adds the given endpoints to the store and publishes them
+func (fd *failureDetector) restoreEndpoints(endpoints []*WeightedEndpointStatus) {
+	if len(endpoints) == 0 {
+		return
+	}
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+	restoredServices := []serviceName{}
+	for _, endpoint := range endpoints {
+		name := serviceName{namespace: endpoint.namespace, service: endpoint.service}
+		endpointsStore, ok := fd.store.Get(name)
+		if !ok {
+			endpointsStore = fd.createStoreFn(fd.endpointTTL)
+			fd.store.Add(name, endpointsStore)
+			restoredServices = append(restoredServices, name)
+		}
+		if len(endpoint.history) > fd.historySize {
+			endpoint.history = endpoint.history[len(endpoint.history)-fd.historySize:]
+		}
+		trackedEndpoints := endpointsStore.Len()
+		endpointsStore.Add(endpointKeyFunction(endpoint), endpoint)
+		fd.trackedEndpoints += endpointsStore.Len() - trackedEndpoints
+		restoredServices = append(restoredServices, fd.enforceLimits(name)...)
+	}
+	fd.propagateChangesToReadOnlyStore(restoredServices...)
+}
+
+func toCheckpointEndpoints(endpoints []*WeightedEndpointStatus) []checkpointEndpoint {
+	entries := make([]checkpointEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.url == nil {
+			continue
+		}
+		entry := checkpointEndpoint{
+			Namespace:       endpoint.namespace,
+			Service:         endpoint.service,
+			URL:             endpoint.url.String(),
+			Reason:          endpoint.status,
+			Weight:          endpoint.weight,
+			LastUpdate:      endpoint.lastUpdate,
+			DecisionReason:  endpoint.reason,
+			Message:         endpoint.message,
+			DecisionSamples: endpoint.decisionSamples,
+			DecisionErrors:  endpoint.decisionErrors,
+			History:         endpoint.history,
+		}
+		if !endpoint.lastTransition.IsZero() {
+			lastTransition := endpoint.lastTransition
+			entry.LastTransition = &lastTransition
+		}
+		if endpoint.key != HostEndpointKey(endpoint.url, "") {
+			// the default key is derived from the URL on restore
+			entry.Key = endpoint.key
+		}
+		for _, sample := range endpoint.Get() {
+			checkpointSample := checkpointSample{Failed: sample.err != nil, Active: sample.active, Count: sample.count, Latency: sample.latency}
+			if !sample.timestamp.IsZero() {
+				timestamp := sample.timestamp
+				checkpointSample.Time = &timestamp
+			}
+			if sample.err != nil {
+				checkpointSample.Err = sample.err.Error()
+			}
+			entry.Samples = append(entry.Samples, checkpointSample)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// writeCheckpointFile writes the given entries to a temporary file which then replaces the given file,
+// that way readers never observe a partially written checkpoint
+func writeCheckpointFile(path string, now time.Time, entries []checkpointEndpoint) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeCheckpoint(tmp, now, entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeCheckpoint(w io.Writer, now time.Time, entries []checkpointEndpoint) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	if err := encoder.Encode(checkpointHeader{Version: checkpointVersion, Timestamp: now}); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readCheckpoint decodes endpoints from the given reader, entries that haven't been updated within maxAge, invalid entries and corrupted lines are skipped.
+// On error the endpoints decoded before the error are returned
+func readCheckpoint(r io.Reader, now time.Time, maxAge time.Duration, newEndpointFn func(url *url.URL) *WeightedEndpointStatus) ([]*WeightedEndpointStatus, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header := checkpointHeader{}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+	if header.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", header.Version, checkpointVersion)
+	}
+
+	endpoints := []*WeightedEndpointStatus{}
+	for lineNumber := 2; ; lineNumber++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return endpoints, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			if endpoint, ok := readCheckpointEndpoint(line, lineNumber, now, maxAge, newEndpointFn); ok {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+		if err == io.EOF {
+			return endpoints, nil
+		}
+	}
+}
+
+// readCheckpointEndpoint decodes a single line of a checkpoint file, corrupted lines and invalid entries are reported and skipped
+func readCheckpointEndpoint(line []byte, lineNumber int, now time.Time, maxAge time.Duration, newEndpointFn func(url *url.URL) *WeightedEndpointStatus) (*WeightedEndpointStatus, bool) {
+	entry := checkpointEndpoint{}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		utilruntime.HandleError(fmt.Errorf("skipping corrupted checkpoint line %d: %v", lineNumber, err))
+		return nil, false
+	}
+	if maxAge > 0 && now.Sub(entry.LastUpdate) > maxAge {
+		return nil, false
+	}
+	endpoint, err := fromCheckpointEndpoint(entry, newEndpointFn)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("skipping checkpoint entry %s/%s %q: %v", entry.Namespace, entry.Service, entry.URL, err))
+		return nil, false
+	}
+	return endpoint, true
+}
+
+func fromCheckpointEndpoint(entry checkpointEndpoint, newEndpointFn func(url *url.URL) *WeightedEndpointStatus) (*WeightedEndpointStatus, error) {
+	if len(entry.Namespace) == 0 || len(entry.Service) == 0 {
+		return nil, errors.New("missing namespace or service")
+	}
+	u, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(float64(entry.Weight)) || entry.Weight < 0 || entry.Weight > 1 {
+		return nil, fmt.Errorf("invalid weight %v", entry.Weight)
+	}
+
+	endpoint := newEndpointFn(u)
+	if len(entry.Key) > 0 {
+		endpoint.key = entry.Key
+	}
+	endpoint.namespace = entry.Namespace
+	endpoint.service = entry.Service
+	endpoint.status = entry.Reason
+	endpoint.weight = entry.Weight
+	endpoint.lastUpdate = entry.LastUpdate
+	if entry.LastTransition != nil {
+		endpoint.lastTransition = *entry.LastTransition
+	}
+	endpoint.reason = entry.DecisionReason
+	endpoint.message = entry.Message
+	endpoint.decisionSamples = entry.DecisionSamples
+	endpoint.decisionErrors = entry.DecisionErrors
+	endpoint.history = entry.History
+	for _, checkpointSample := range entry.Samples {
+		sample := &Sample{active: checkpointSample.Active, count: checkpointSample.Count, latency: checkpointSample.Latency, timestamp: entry.LastUpdate}
+		if checkpointSample.Time != nil {
+			sample.timestamp = *checkpointSample.Time
+		}
+		if checkpointSample.Failed {
+			sample.err = errors.New(checkpointSample.Err)
+		}
+		endpoint.Add(sample)
+	}
+	return endpoint, nil
+}
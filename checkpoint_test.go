@@ -0,0 +1,156 @@
+package failure_detector
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	endpointA := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	endpointB := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	path := filepath.Join(t.TempDir(), "checkpoint")
+
+	source := NewDefaultFailureDetector(WithCheckpoint(path, time.Minute, time.Hour))
+	source.clock = clock.NewFakeClock(now)
+	samples := append(genSamples(endpointA, 100, true), genSamples(endpointB, 15, true)...)
+	for _, endpointSample := range samples {
+		source.processBatch([]*EndpointSample{endpointSample})
+	}
+	source.writeCheckpoint()
+
+	target := NewDefaultFailureDetector(WithCheckpoint(path, time.Minute, time.Hour))
+	target.clock = clock.NewFakeClock(now.Add(time.Minute))
+	target.restoreCheckpoint()
+
+	for _, endpoint := range []*url.URL{endpointA, endpointB} {
+		expectedIsHealthy, expectedWeight := source.EndpointStatus("ns", "etcd", endpoint)
+		isHealthy, weight := target.EndpointStatus("ns", "etcd", endpoint)
+		if isHealthy != expectedIsHealthy || weight != expectedWeight {
+			t.Fatalf("expected %s to be restored with isHealthy = %v, weight = %v, got %v, %v", endpoint.Host, expectedIsHealthy, expectedWeight, isHealthy, weight)
+		}
+	}
+
+	// the recent samples have been restored as well
+	endpointsStore, _ := target.store.Get(serviceName{namespace: "ns", service: "etcd"})
+	restoredEndpoint, _ := endpointsStore.Get(endpointB.Host)
+	if samples := restoredEndpoint.Get(); len(samples) != 5 || samples[0].Err() == nil {
+		t.Fatalf("expected 5 failed samples to be restored, got %v", samples)
+	}
+
+	// so have the last decision and the history
+	for _, endpoint := range []*url.URL{endpointA, endpointB} {
+		expectedDetails := source.EndpointStatusDetails("ns", "etcd", endpoint)
+		if details := target.EndpointStatusDetails("ns", "etcd", endpoint); !reflect.DeepEqual(details, expectedDetails) {
+			t.Fatalf("expected the details of %s to be restored as %+v, got %+v", endpoint.Host, expectedDetails, details)
+		}
+	}
+	if expected, actual := source.Snapshot().Services, target.Snapshot().Services; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected the history to be restored as %+v, got %+v", expected, actual)
+	}
+}
+
+func TestReadCheckpoint(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := fmt.Sprintf(`{"version":1,"timestamp":%q}`, now.Format(time.RFC3339))
+	entry := func(host string, weight float32, lastUpdate time.Time) string {
+		return fmt.Sprintf(`{"namespace":"ns","service":"etcd","url":"https://%s","reason":"TooManyErrors","weight":%v,"lastUpdate":%q,"samples":[{"err":"nasty error","failed":true},{}]}`, host, weight, lastUpdate.Format(time.RFC3339))
+	}
+
+	scenarios := []struct {
+		name          string
+		content       string
+		expectedHosts []string
+		expectError   bool
+	}{
+		{
+			name:          "valid checkpoint",
+			content:       strings.Join([]string{header, entry("1.1.1.1", 0, now), entry("1.1.1.2", 0.5, now)}, "\n"),
+			expectedHosts: []string{"1.1.1.1", "1.1.1.2"},
+		},
+		{
+			name:          "entries older than max age are ignored",
+			content:       strings.Join([]string{header, entry("1.1.1.1", 0, now.Add(-2*time.Hour)), entry("1.1.1.2", 0.5, now.Add(-time.Minute))}, "\n"),
+			expectedHosts: []string{"1.1.1.2"},
+		},
+		{
+			name:          "invalid entries are skipped",
+			content:       strings.Join([]string{header, entry("1.1.1.1", 7, now), entry("1.1.1.2", 0.5, now)}, "\n"),
+			expectedHosts: []string{"1.1.1.2"},
+		},
+		{
+			name:          "partial file yields entries written before the corruption",
+			content:       strings.Join([]string{header, entry("1.1.1.1", 0, now), entry("1.1.1.2", 0.5, now)[:40]}, "\n"),
+			expectedHosts: []string{"1.1.1.1"},
+		},
+		{
+			name:          "corrupted lines are skipped",
+			content:       strings.Join([]string{header, entry("1.1.1.1", 0, now)[:40], "garbage", "", entry("1.1.1.2", 0.5, now)}, "\n"),
+			expectedHosts: []string{"1.1.1.2"},
+		},
+		{
+			name:        "corrupted header",
+			content:     "garbage",
+			expectError: true,
+		},
+		{
+			name:        "unsupported version",
+			content:     strings.Join([]string{`{"version":2}`, entry("1.1.1.1", 0, now)}, "\n"),
+			expectError: true,
+		},
+		{
+			name:        "empty file",
+			expectError: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			endpoints, err := readCheckpoint(strings.NewReader(scenario.content), now, time.Hour, NewDefaultFailureDetector().newEndpoint)
+			if scenario.expectError != (err != nil) {
+				t.Fatalf("expected error = %v, got %v", scenario.expectError, err)
+			}
+
+			actualHosts := []string{}
+			for _, endpoint := range endpoints {
+				actualHosts = append(actualHosts, endpoint.url.Hostname())
+				if len(endpoint.Get()) != 2 || endpoint.status != EndpointStatusReasonTooManyErrors {
+					t.Fatalf("expected the status and samples to be restored, got %+v", endpoint)
+				}
+			}
+			if len(actualHosts) == 0 && len(scenario.expectedHosts) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(actualHosts, scenario.expectedHosts) {
+				t.Fatalf("expected %v endpoints but got %v", scenario.expectedHosts, actualHosts)
+			}
+		})
+	}
+}
+
+func TestWriteCheckpointFormat(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	endpoint := newWeightedEndpoint(defaultWindowSize, &url.URL{Scheme: "https", Host: "1.1.1.1:6443"})
+	endpoint.namespace, endpoint.service, endpoint.weight, endpoint.lastUpdate = "ns", "etcd", 0.5, now
+	endpoint.Add(&Sample{err: fmt.Errorf("nasty error")})
+
+	buf := &bytes.Buffer{}
+	if err := writeCheckpoint(buf, now, toCheckpointEndpoints([]*WeightedEndpointStatus{endpoint})); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"version":1,"timestamp":"2020-01-01T00:00:00Z"}
+{"namespace":"ns","service":"etcd","url":"https://1.1.1.1:6443","weight":0.5,"lastUpdate":"2020-01-01T00:00:00Z","samples":[{"err":"nasty error","failed":true}]}
+`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,317 @@
+// fd-loadgen drives a failure detector with synthetic traffic for many Services and endpoints
+// with configurable error rates, latency distributions and scheduled outages.
+// It reports the detection latency (time to eject), the false-positive rate and the throughput
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	failuredetector "github.com/p0lyn0mial/failure-detector"
+)
+
+// outage makes a fraction of endpoints fail at the given error rate between start and end (measured from the beginning of the run)
+type outage struct {
+	fraction  float64
+	start     time.Duration
+	end       time.Duration
+	errorRate float64
+}
+
+// outages implements flag.Value, each outage is specified as fraction:start:end[:errorRate], for example 0.1:5s:20s
+type outages []outage
+
+func (o *outages) String() string {
+	entries := []string{}
+	for _, entry := range *o {
+		entries = append(entries, fmt.Sprintf("%v:%v:%v:%v", entry.fraction, entry.start, entry.end, entry.errorRate))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (o *outages) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return fmt.Errorf("expected fraction:start:end[:errorRate], got %q", value)
+	}
+	entry := outage{errorRate: 1}
+	var err error
+	if entry.fraction, err = strconv.ParseFloat(parts[0], 64); err != nil || entry.fraction <= 0 || entry.fraction > 1 {
+		return fmt.Errorf("invalid fraction %q", parts[0])
+	}
+	if entry.start, err = time.ParseDuration(parts[1]); err != nil {
+		return fmt.Errorf("invalid start %q: %v", parts[1], err)
+	}
+	if entry.end, err = time.ParseDuration(parts[2]); err != nil || entry.end <= entry.start {
+		return fmt.Errorf("invalid end %q", parts[2])
+	}
+	if len(parts) == 4 {
+		if entry.errorRate, err = strconv.ParseFloat(parts[3], 64); err != nil || entry.errorRate < 0 || entry.errorRate > 1 {
+			return fmt.Errorf("invalid error rate %q", parts[3])
+		}
+	}
+	*o = append(*o, entry)
+	return nil
+}
+
+type config struct {
+	services      int
+	endpoints     int
+	duration      time.Duration
+	rate          int
+	producers     int
+	errorRate     float64
+	latencyMedian time.Duration
+	latencySigma  float64
+	outages       outages
+	pollInterval  time.Duration
+	overflow      string
+	seed          int64
+}
+
+// endpoint holds the state of a single simulated endpoint
+type endpoint struct {
+	namespace string
+	service   string
+	url       *url.URL
+
+	// outage is nil for endpoints that never fail beyond the baseline error rate
+	outage *outage
+
+	// detected is set once the endpoint has been ejected during its outage,
+	// detectedAfter is the time between the beginning of the outage and the ejection
+	detected      bool
+	detectedAfter time.Duration
+
+	// falsePositive is set when the endpoint was ejected without an outage or before its outage started
+	falsePositive bool
+}
+
+func (e *endpoint) errorRate(cfg *config, elapsed time.Duration) float64 {
+	if e.outage != nil && elapsed >= e.outage.start && elapsed < e.outage.end {
+		return e.outage.errorRate
+	}
+	return cfg.errorRate
+}
+
+func main() {
+	cfg := &config{}
+	flag.IntVar(&cfg.services, "services", 100, "the number of Services")
+	flag.IntVar(&cfg.endpoints, "endpoints", 5, "the number of endpoints per Service")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "the duration of the run")
+	flag.IntVar(&cfg.rate, "rate", 0, "the total number of samples per second, 0 means as fast as possible")
+	flag.IntVar(&cfg.producers, "producers", runtime.GOMAXPROCS(0), "the number of goroutines recording samples")
+	flag.Float64Var(&cfg.errorRate, "error-rate", 0.01, "the baseline fraction of failed requests")
+	flag.DurationVar(&cfg.latencyMedian, "latency-median", 20*time.Millisecond, "the median of the log-normal latency distribution")
+	flag.Float64Var(&cfg.latencySigma, "latency-sigma", 0.5, "the sigma of the log-normal latency distribution")
+	flag.Var(&cfg.outages, "outage", "an outage specified as fraction:start:end[:errorRate], for example 0.1:5s:20s, can be repeated")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 10*time.Millisecond, "how often the status of endpoints is checked")
+	flag.StringVar(&cfg.overflow, "overflow", string(failuredetector.OverflowDropNewest), "the overflow strategy: DropNewest, DropOldest or Sample")
+	flag.Int64Var(&cfg.seed, "seed", 1, "the seed for the pseudo-random generators")
+	flag.Parse()
+
+	if cfg.services <= 0 || cfg.endpoints <= 0 || cfg.producers <= 0 {
+		fmt.Fprintln(os.Stderr, "error: services, endpoints and producers must be positive")
+		os.Exit(1)
+	}
+	overflowPolicy := failuredetector.OverflowPolicy{Strategy: failuredetector.OverflowStrategy(cfg.overflow), Fraction: 0.5}
+	if err := overflowPolicy.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	run(cfg, overflowPolicy)
+}
+
+func run(cfg *config, overflowPolicy failuredetector.OverflowPolicy) {
+	endpoints := newEndpoints(cfg)
+	detector := failuredetector.NewDefaultFailureDetector(failuredetector.WithOverflowPolicy(overflowPolicy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+	go detector.Run(ctx)
+
+	start := time.Now()
+	var recorded, accepted uint64
+	wg := sync.WaitGroup{}
+	for p := 0; p < cfg.producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			r, a := produce(ctx, cfg, detector, endpoints, p, start)
+			atomic.AddUint64(&recorded, r)
+			atomic.AddUint64(&accepted, a)
+		}(p)
+	}
+
+	monitor(ctx, cfg, detector, endpoints, start)
+	wg.Wait()
+	elapsed := time.Since(start)
+	report(cfg, endpoints, elapsed, recorded, accepted, detector.DroppedSamples(), detector.ProcessedSamples())
+}
+
+// newEndpoints creates all endpoints and assigns them to outages, endpoints are shuffled so that outages span many Services
+func newEndpoints(cfg *config) []*endpoint {
+	endpoints := []*endpoint{}
+	for s := 0; s < cfg.services; s++ {
+		for e := 0; e < cfg.endpoints; e++ {
+			endpoints = append(endpoints, &endpoint{
+				namespace: fmt.Sprintf("ns-%d", s%10),
+				service:   fmt.Sprintf("svc-%d", s),
+				url:       &url.URL{Scheme: "https", Host: fmt.Sprintf("10.%d.%d.%d:443", s/256, s%256, e)},
+			})
+		}
+	}
+
+	r := rand.New(rand.NewSource(cfg.seed))
+	order := r.Perm(len(endpoints))
+	next := 0
+	for i := range cfg.outages {
+		count := int(math.Ceil(cfg.outages[i].fraction * float64(len(endpoints))))
+		for j := 0; j < count && next < len(order); j++ {
+			endpoints[order[next]].outage = &cfg.outages[i]
+			next++
+		}
+	}
+	return endpoints
+}
+
+// produce records samples for every endpoint assigned to the given producer until the context is done
+func produce(ctx context.Context, cfg *config, detector Detector, endpoints []*endpoint, p int, start time.Time) (recorded, accepted uint64) {
+	r := rand.New(rand.NewSource(cfg.seed + int64(p) + 1))
+	own := []*endpoint{}
+	for i := p; i < len(endpoints); i += cfg.producers {
+		own = append(own, endpoints[i])
+	}
+	if len(own) == 0 {
+		return 0, 0
+	}
+
+	// with a rate limit samples are sent in small bursts every 10ms
+	burst := math.MaxInt32
+	var ticker *time.Ticker
+	if cfg.rate > 0 {
+		burst = int(math.Max(1, float64(cfg.rate)/float64(cfg.producers)/100))
+		ticker = time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+	}
+
+	for i := 0; ; {
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return recorded, accepted
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return recorded, accepted
+		}
+
+		elapsed := time.Since(start)
+		for b := 0; b < burst && b < 1000; b++ {
+			ep := own[i%len(own)]
+			i++
+
+			var err error
+			if r.Float64() < ep.errorRate(cfg, elapsed) {
+				err = fmt.Errorf("synthetic error")
+			}
+			latency := time.Duration(float64(cfg.latencyMedian) * math.Exp(cfg.latencySigma*r.NormFloat64()))
+
+			recorded++
+			if detector.Record(&failuredetector.EndpointSample{Namespace: ep.namespace, Service: ep.service, URL: ep.url, Err: err, Latency: latency}) {
+				accepted++
+			}
+		}
+	}
+}
+
+// Detector is the subset of the detector's API used by the load generator
+type Detector interface {
+	Record(endpointSample *failuredetector.EndpointSample) bool
+	EndpointStatus(namespace, service string, url *url.URL) (isHealthy bool, weight float32)
+}
+
+// monitor periodically checks the status of all endpoints until the context is done
+func monitor(ctx context.Context, cfg *config, detector Detector, endpoints []*endpoint, start time.Time) {
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		elapsed := time.Since(start)
+		for _, ep := range endpoints {
+			isHealthy, _ := detector.EndpointStatus(ep.namespace, ep.service, ep.url)
+			if isHealthy {
+				continue
+			}
+			if ep.outage == nil || elapsed < ep.outage.start {
+				ep.falsePositive = true
+				continue
+			}
+			if !ep.detected {
+				ep.detected = true
+				ep.detectedAfter = elapsed - ep.outage.start
+			}
+		}
+	}
+}
+
+func report(cfg *config, endpoints []*endpoint, elapsed time.Duration, recorded, accepted, dropped, processed uint64) {
+	detectionLatencies := []time.Duration{}
+	outageEndpoints, falsePositives := 0, 0
+	for _, ep := range endpoints {
+		if ep.falsePositive {
+			falsePositives++
+		}
+		if ep.outage == nil {
+			continue
+		}
+		if elapsed < ep.outage.start {
+			// the outage hasn't started
+			continue
+		}
+		outageEndpoints++
+		if ep.detected {
+			detectionLatencies = append(detectionLatencies, ep.detectedAfter)
+		}
+	}
+	sort.Slice(detectionLatencies, func(i, j int) bool { return detectionLatencies[i] < detectionLatencies[j] })
+
+	fmt.Printf("services: %d, endpoints: %d, duration: %v\n", cfg.services, len(endpoints), elapsed.Round(time.Millisecond))
+	fmt.Printf("samples: recorded %d, accepted %d, dropped %d, processed %d\n", recorded, accepted, dropped, processed)
+	fmt.Printf("throughput: recorded %.0f samples/s, processed %.0f samples/s\n", float64(recorded)/elapsed.Seconds(), float64(processed)/elapsed.Seconds())
+	if outageEndpoints > 0 {
+		fmt.Printf("detection: %d of %d endpoints in an outage ejected", len(detectionLatencies), outageEndpoints)
+		if len(detectionLatencies) > 0 {
+			fmt.Printf(", time to eject min %v, p50 %v, p99 %v, max %v",
+				detectionLatencies[0], quantile(detectionLatencies, 0.5), quantile(detectionLatencies, 0.99), detectionLatencies[len(detectionLatencies)-1])
+		}
+		fmt.Println()
+	}
+	fmt.Printf("false positives: %d of %d endpoints ejected without an outage or before it started (%.2f%%)\n", falsePositives, len(endpoints), 100*float64(falsePositives)/float64(len(endpoints)))
+}
+
+// quantile returns the q-quantile of the given sorted durations
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
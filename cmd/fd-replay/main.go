@@ -0,0 +1,87 @@
+// fd-replay replays a trace of EndpointSamples recorded by the failure detector (see WithTraceWriter)
+// against a policy using a simulated clock and prints the resulting status timeline per endpoint
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	failuredetector "github.com/p0lyn0mial/failure-detector"
+)
+
+// policies holds the policies a trace can be replayed against
+var policies = map[string]failuredetector.EvaluateFunc{
+	"simple": failuredetector.SimpleWeightedEndpointStatusEvaluator,
+	"ewma":   failuredetector.NewEWMAPolicy(failuredetector.DefaultEWMAPolicyConfig),
+}
+
+func main() {
+	tracePath := flag.String("trace", "", "path to the trace file, stdin is used when empty")
+	policyName := flag.String("policy", "simple", fmt.Sprintf("the policy to replay the trace against, one of: %s", strings.Join(policyNames(), ", ")))
+	flag.Parse()
+
+	if err := run(*tracePath, *policyName); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(tracePath, policyName string) error {
+	policy, ok := policies[policyName]
+	if !ok {
+		return fmt.Errorf("unknown policy %q, available policies: %s", policyName, strings.Join(policyNames(), ", "))
+	}
+
+	trace := os.Stdin
+	if len(tracePath) > 0 {
+		f, err := os.Open(tracePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		trace = f
+	}
+
+	timelines := map[string][]failuredetector.ReplayEvent{}
+	err := failuredetector.Replay(bufio.NewReader(trace), policy, func(event failuredetector.ReplayEvent) {
+		key := fmt.Sprintf("%s/%s %s", event.Namespace, event.Service, event.Endpoint)
+		timelines[key] = append(timelines[key], event)
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoints := make([]string, 0, len(timelines))
+	for endpoint := range timelines {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(out, "%s\n", endpoint)
+		for _, event := range timelines[endpoint] {
+			status := event.Status
+			if len(status) == 0 {
+				status = "Healthy"
+			}
+			fmt.Fprintf(out, "  %s  weight=%.2f  %s\n", event.Timestamp.Format(time.RFC3339Nano), event.Weight, status)
+		}
+	}
+	return nil
+}
+
+func policyNames() []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
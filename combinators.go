@@ -0,0 +1,162 @@
+package failure_detector
+
+import "fmt"
+
+// PolicyReasonNotEnoughSamples means the endpoint hasn't collected enough samples to be assessed, see WithMinimumSamples
+const PolicyReasonNotEnoughSamples = "NotEnoughSamples"
+
+// AnyOf returns a policy that considers an endpoint unhealthy when any of the given policies does.
+// All policies assess the same endpoint and their decisions are merged as follows:
+//  - the weight is the lowest weight returned by the policies
+//  - the status, the reason and the explanation come from the first policy that considers the endpoint unhealthy,
+//     when all policies consider the endpoint healthy they come from the first policy that returned the lowest weight
+//  - the samples are reset when any of the policies asks for it
+//  - every policy gets back its own PolicyResult.State
+func AnyOf(policies ...EvaluateFunc) EvaluateFunc {
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return mergePolicyResults(endpoint, policies,
+			func(result, merged PolicyResult) bool {
+				return len(merged.Status) == 0 && (len(result.Status) > 0 || result.Weight < merged.Weight)
+			},
+			func(result, merged PolicyResult) float32 {
+				if result.Weight < merged.Weight {
+					return result.Weight
+				}
+				return merged.Weight
+			})
+	}
+}
+
+// AllOf returns a policy that considers an endpoint unhealthy only when all the given policies do.
+// All policies assess the same endpoint and their decisions are merged as follows:
+//  - the weight is the highest weight returned by the policies
+//  - the status, the reason and the explanation come from the first policy that considers the endpoint healthy,
+//     when all policies consider the endpoint unhealthy they come from the first policy that returned the highest weight
+//  - the samples are reset when any of the policies asks for it
+//  - every policy gets back its own PolicyResult.State
+func AllOf(policies ...EvaluateFunc) EvaluateFunc {
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return mergePolicyResults(endpoint, policies,
+			func(result, merged PolicyResult) bool {
+				return len(merged.Status) > 0 && (len(result.Status) == 0 || result.Weight > merged.Weight)
+			},
+			func(result, merged PolicyResult) float32 {
+				if result.Weight > merged.Weight {
+					return result.Weight
+				}
+				return merged.Weight
+			})
+	}
+}
+
+// mergePolicyResults evaluates the given policies against the endpoint and merges their decisions,
+// winsFn tells whether a decision replaces the status, the reason and the explanation merged so far and weightFn picks the merged weight.
+// Every policy assesses a copy of the endpoint that carries its own state, no policies keep the current status and weight
+func mergePolicyResults(endpoint *WeightedEndpointStatus, policies []EvaluateFunc, winsFn func(result, merged PolicyResult) bool, weightFn func(result, merged PolicyResult) float32) PolicyResult {
+	merged := endpoint.current()
+	if len(policies) == 0 {
+		return merged
+	}
+	previousStates := combinedStates(endpoint, len(policies))
+	states := make(combinedPolicyState, len(policies))
+
+	for i, policy := range policies {
+		view := *endpoint
+		view.policyState = previousStates[i]
+		result := policy(&view)
+		states[i] = result.State
+		if i == 0 {
+			merged = result
+			continue
+		}
+
+		weight := weightFn(result, merged)
+		resetSamples := merged.ResetSamples || result.ResetSamples
+		if winsFn(result, merged) {
+			merged = result
+		}
+		merged.Weight = weight
+		merged.ResetSamples = resetSamples
+	}
+	merged.State = states.orNil()
+	return merged
+}
+
+// Sequence returns a policy that runs the given policies one after another,
+// every policy assesses the endpoint with the status and the weight decided by the previous ones (and without samples once they have been reset).
+// The decision of the last policy wins, the reason and the explanation come from the last policy that provided a reason
+// and the samples are reset when any of the policies asks for it. Every policy gets back its own PolicyResult.State
+func Sequence(policies ...EvaluateFunc) EvaluateFunc {
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		merged := endpoint.current()
+		if len(policies) == 0 {
+			return merged
+		}
+		previousStates := combinedStates(endpoint, len(policies))
+		states := make(combinedPolicyState, len(policies))
+
+		// policies must not modify the endpoint, thus the decisions are applied to a copy
+		view := *endpoint
+		for i, policy := range policies {
+			view.policyState = previousStates[i]
+			result := policy(&view)
+			states[i] = result.State
+
+			view.status, view.weight = result.Status, result.Weight
+			if result.ResetSamples {
+				// the samples (and the counters) are shared with the endpoint
+				view.data, view.position = make([]*Sample, view.size), 0
+				if view.window != nil {
+					view.window = newTimeWindow(view.window.window(), view.window.bucketSize)
+				}
+			}
+
+			merged.Status = result.Status
+			merged.Weight = result.Weight
+			merged.ResetSamples = merged.ResetSamples || result.ResetSamples
+			if len(result.Reason) > 0 {
+				merged.Reason = result.Reason
+				merged.Explanation = result.Explanation
+			}
+		}
+		merged.State = states.orNil()
+		return merged
+	}
+}
+
+// combinedPolicyState holds PolicyResult.State of every policy of a combinator
+type combinedPolicyState []interface{}
+
+// orNil returns nil when none of the policies returned a state so that stateless combinators don't keep one
+func (s combinedPolicyState) orNil() interface{} {
+	for _, state := range s {
+		if state != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// combinedStates returns the states the given number of policies of a combinator returned the last time
+func combinedStates(endpoint *WeightedEndpointStatus, policies int) combinedPolicyState {
+	if states, ok := endpoint.policyState.(combinedPolicyState); ok && len(states) == policies {
+		return states
+	}
+	return make(combinedPolicyState, policies)
+}
+
+// WithMinimumSamples returns a policy that keeps the current status and weight of an endpoint until it collects the given number of samples,
+// after that the endpoint is assessed by the given policy.
+// Note that the number of samples is bounded by the window (see WithWindowSize and WithTimeWindow) and some policies reset the samples once they change the weight
+func WithMinimumSamples(minimum int, policy EvaluateFunc) EvaluateFunc {
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		collected, _, _ := endpoint.sampleCounts()
+		if collected < minimum {
+			result := endpoint.current()
+			result.Reason = PolicyReasonNotEnoughSamples
+			result.Explanation = fmt.Sprintf("collected %d out of %d required samples", collected, minimum)
+			return result
+		}
+		return policy(endpoint)
+	}
+}
@@ -0,0 +1,103 @@
+package failure_detector
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPolicyCombinators(t *testing.T) {
+	decide := func(status string, weight float32, reason string) EvaluateFunc {
+		return func(_ *WeightedEndpointStatus) PolicyResult {
+			return PolicyResult{Status: status, Weight: weight, Reason: reason}
+		}
+	}
+	reset := func(policy EvaluateFunc) EvaluateFunc {
+		return func(endpoint *WeightedEndpointStatus) PolicyResult {
+			result := policy(endpoint)
+			result.ResetSamples = true
+			return result
+		}
+	}
+	halveWeight := func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return PolicyResult{Status: endpoint.Status(), Weight: endpoint.Weight() / 2}
+	}
+	countSamples := func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return PolicyResult{Weight: float32(len(endpoint.Get())) / 10, Reason: "Counted"}
+	}
+
+	scenarios := []struct {
+		name           string
+		policy         EvaluateFunc
+		expectedResult PolicyResult
+	}{
+		{name: "AnyOf without policies", policy: AnyOf(), expectedResult: PolicyResult{Weight: 1}},
+		{name: "AnyOf an unhealthy decision wins", policy: AnyOf(decide("", 0.8, "A"), decide("B", 0.5, "B")), expectedResult: PolicyResult{Status: "B", Weight: 0.5, Reason: "B"}},
+		{name: "AnyOf the first unhealthy decision wins", policy: AnyOf(decide("A", 0.3, "A"), decide("B", 0.1, "B")), expectedResult: PolicyResult{Status: "A", Weight: 0.1, Reason: "A"}},
+		{name: "AnyOf the lowest weight wins", policy: AnyOf(decide("", 0.8, "A"), decide("", 0.6, "B"), decide("", 0.6, "C")), expectedResult: PolicyResult{Weight: 0.6, Reason: "B"}},
+		{name: "AllOf a healthy decision wins", policy: AllOf(decide("A", 0, "A"), decide("", 0.7, "B")), expectedResult: PolicyResult{Weight: 0.7, Reason: "B"}},
+		{name: "AllOf the first healthy decision wins", policy: AllOf(decide("", 0.5, "A"), decide("", 0.9, "B")), expectedResult: PolicyResult{Weight: 0.9, Reason: "A"}},
+		{name: "AllOf the highest weight wins", policy: AllOf(decide("A", 0, "A"), decide("B", 0.2, "B")), expectedResult: PolicyResult{Status: "B", Weight: 0.2, Reason: "B"}},
+		{name: "samples are reset when any policy asks for it", policy: AllOf(decide("", 1, ""), reset(decide("", 1, ""))), expectedResult: PolicyResult{Weight: 1, ResetSamples: true}},
+		{name: "Sequence without policies", policy: Sequence(), expectedResult: PolicyResult{Weight: 1}},
+		{name: "Sequence passes decisions on", policy: Sequence(decide("A", 0.5, "A"), halveWeight), expectedResult: PolicyResult{Status: "A", Weight: 0.25, Reason: "A"}},
+		{name: "Sequence the last decision wins", policy: Sequence(decide("A", 0.5, "A"), decide("", 0.7, "B")), expectedResult: PolicyResult{Weight: 0.7, Reason: "B"}},
+		{name: "Sequence passes reset samples on", policy: Sequence(countSamples, reset(decide("", 1, "")), countSamples), expectedResult: PolicyResult{Weight: 0, Reason: "Counted", ResetSamples: true}},
+		{name: "not enough samples", policy: WithMinimumSamples(4, decide("A", 0, "A")), expectedResult: PolicyResult{Weight: 1, Reason: PolicyReasonNotEnoughSamples, Explanation: "collected 3 out of 4 required samples"}},
+		{name: "enough samples", policy: WithMinimumSamples(3, decide("A", 0, "A")), expectedResult: PolicyResult{Status: "A", Weight: 0, Reason: "A"}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			endpoint := createWeightedEndpointStatus(errToSampleFunc(genErrors(3)...))
+			actualResult := scenario.policy(endpoint)
+			if actualResult != scenario.expectedResult {
+				t.Fatalf("expected %+v but got %+v", scenario.expectedResult, actualResult)
+			}
+			if endpoint.status != "" || endpoint.weight != 1 || len(endpoint.Get()) != 3 {
+				t.Fatalf("the policy must not modify the endpoint, got %q status, %v weight and %d samples", endpoint.status, endpoint.weight, len(endpoint.Get()))
+			}
+		})
+	}
+}
+
+func TestComposedPolicy(t *testing.T) {
+	target := NewDefaultFailureDetector(WithPolicies([]PolicyRule{{Namespace: "ns", Service: "etcd", Policy: WithMinimumSamples(defaultWindowSize, AnyOf(
+		NewSimplePolicy(SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 100}),
+		NewSimplePolicy(SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 10}),
+	))}}))
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+
+	samples := genSamples(endpoint, 10, true)
+	target.processBatch(samples[:5])
+	if isHealthy, weight := target.EndpointStatus("ns", "etcd", endpoint); !isHealthy || weight != 1 {
+		t.Fatalf("expected a healthy endpoint with the weight of 1 until it collects enough samples, got %v and %v", isHealthy, weight)
+	}
+	target.processBatch(samples[5:])
+	if isHealthy, weight := target.EndpointStatus("ns", "etcd", endpoint); isHealthy || weight != 0 {
+		t.Fatalf("expected the endpoint to be ejected by the stricter policy, got %v and %v", isHealthy, weight)
+	}
+}
+
+func TestCombinedPolicyState(t *testing.T) {
+	lowWeight := func(_ *WeightedEndpointStatus) PolicyResult {
+		return PolicyResult{Weight: 0.5}
+	}
+	policy := AnyOf(NewSimplePolicy(SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 100}), lowWeight)
+	endpoint := newWeightedEndpoint(defaultWindowSize, nil)
+
+	// the simple policy counts its own errors regardless of the weight decided by the other policy
+	for _, expectedWeight := range []float32{0.9, 0.8} {
+		for _, err := range genErrors(10) {
+			endpoint.Add(&Sample{err: err})
+		}
+		endpoint.apply(policy(endpoint))
+
+		states, ok := endpoint.PolicyState().(combinedPolicyState)
+		if !ok || len(states) != 2 || states[1] != nil {
+			t.Fatalf("expected the state of the simple policy only, got %#v", endpoint.PolicyState())
+		}
+		if state := states[0].(simplePolicyState); state.weight != expectedWeight || endpoint.weight != 0.5 {
+			t.Fatalf("expected the simple policy to decide the weight of %v and the endpoint to have the weight of 0.5, got %v and %v", expectedWeight, state.weight, endpoint.weight)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package failure_detector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigAPIVersion is the only version of the configuration document supported so far
+const ConfigAPIVersion = "failuredetector/v1"
+
+// Config is a declarative configuration of the detector, it is usually loaded from a YAML or JSON file (see LoadConfigFile).
+// Zero values mean the defaults
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+
+	// WindowSize the number of recent samples kept and assessed per endpoint, it can't be changed by a reload
+	WindowSize int `json:"windowSize,omitempty"`
+
+	// EndpointTTL the time after which an endpoint that stopped receiving samples is forgotten, it can't be changed by a reload
+	EndpointTTL metav1.Duration `json:"endpointTTL,omitempty"`
+
+	// Workers the number of workers that take batches of samples off the queue, it can't be changed by a reload.
+	// Note that batches are processed one at a time, see WithWorkers
+	Workers int `json:"workers,omitempty"`
+
+	// ChannelCapacity the capacity of the collector channel, it can't be changed by a reload
+	ChannelCapacity int `json:"channelCapacity,omitempty"`
+
+	// Policies assigns policies to Services, the rules follow the semantics of PolicyRule
+	Policies []PolicyConfig `json:"policies,omitempty"`
+
+	Ejection EjectionConfig `json:"ejection,omitempty"`
+
+	Prober ProberConfig `json:"prober,omitempty"`
+}
+
+// PolicyConfig selects the policy for the Services matching the given namespace and service, either of them can be PolicyWildcard
+type PolicyConfig struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+
+	// Type the type of the policy, either PolicyTypeSimple or PolicyTypeEWMA
+	Type string `json:"type"`
+
+	// Simple holds the parameters of PolicyTypeSimple
+	Simple *SimplePolicyConfig `json:"simple,omitempty"`
+
+	// EWMA holds the parameters of PolicyTypeEWMA
+	EWMA *EWMAPolicyConfig `json:"ewma,omitempty"`
+}
+
+const (
+	// PolicyTypeSimple selects the policy returned by NewSimplePolicy
+	PolicyTypeSimple = "simple"
+
+	// PolicyTypeEWMA selects the policy returned by NewEWMAPolicy
+	PolicyTypeEWMA = "ewma"
+)
+
+// EjectionConfig bounds ejections
+type EjectionConfig struct {
+	// MaxEjectionPercent see SetMaxEjectionPercent
+	MaxEjectionPercent int `json:"maxEjectionPercent,omitempty"`
+}
+
+// ProberConfig holds the values used for fields that aren't set in ProbeConfig passed to SetProbeTargets
+type ProberConfig struct {
+	Interval     metav1.Duration `json:"interval,omitempty"`
+	Timeout      metav1.Duration `json:"timeout,omitempty"`
+	JitterFactor float64         `json:"jitterFactor,omitempty"`
+}
+
+// LoadConfigFile reads and validates the configuration from the given YAML or JSON file
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %q: %v", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig decodes and validates the configuration from the given YAML or JSON document, unknown fields are rejected
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration, it reports all problems found at once
+func (c *Config) Validate() error {
+	errs := field.ErrorList{}
+	if len(c.APIVersion) == 0 {
+		errs = append(errs, field.Required(field.NewPath("apiVersion"), fmt.Sprintf("must be %q", ConfigAPIVersion)))
+	} else if c.APIVersion != ConfigAPIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), c.APIVersion, []string{ConfigAPIVersion}))
+	}
+	if c.WindowSize < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("windowSize"), c.WindowSize, "must be greater than or equal to 0"))
+	}
+	if c.EndpointTTL.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("endpointTTL"), c.EndpointTTL.Duration.String(), "must be greater than or equal to 0"))
+	}
+	if c.Workers < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("workers"), c.Workers, "must be greater than or equal to 0"))
+	}
+	if c.ChannelCapacity < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("channelCapacity"), c.ChannelCapacity, "must be greater than or equal to 0"))
+	}
+
+	services := map[serviceName]bool{}
+	for i, policy := range c.Policies {
+		errs = append(errs, policy.validate(field.NewPath("policies").Index(i))...)
+		name := serviceName{namespace: policy.Namespace, service: policy.Service}
+		if services[name] {
+			errs = append(errs, field.Duplicate(field.NewPath("policies").Index(i), fmt.Sprintf("%s/%s", policy.Namespace, policy.Service)))
+		}
+		services[name] = true
+	}
+
+	if percent := c.Ejection.MaxEjectionPercent; percent < 0 || percent > 100 {
+		errs = append(errs, field.Invalid(field.NewPath("ejection", "maxEjectionPercent"), percent, "must be in the [0, 100] range"))
+	}
+
+	proberPath := field.NewPath("prober")
+	if c.Prober.Interval.Duration < 0 {
+		errs = append(errs, field.Invalid(proberPath.Child("interval"), c.Prober.Interval.Duration.String(), "must be greater than or equal to 0"))
+	}
+	if c.Prober.Timeout.Duration < 0 {
+		errs = append(errs, field.Invalid(proberPath.Child("timeout"), c.Prober.Timeout.Duration.String(), "must be greater than or equal to 0"))
+	}
+	if c.Prober.JitterFactor < 0 {
+		errs = append(errs, field.Invalid(proberPath.Child("jitterFactor"), c.Prober.JitterFactor, "must be greater than or equal to 0"))
+	}
+
+	return errs.ToAggregate()
+}
+
+func (p PolicyConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if len(p.Namespace) == 0 {
+		errs = append(errs, field.Required(path.Child("namespace"), fmt.Sprintf("use %q to match any namespace", PolicyWildcard)))
+	}
+	if len(p.Service) == 0 {
+		errs = append(errs, field.Required(path.Child("service"), fmt.Sprintf("use %q to match any service", PolicyWildcard)))
+	}
+
+	switch p.Type {
+	case PolicyTypeSimple:
+		if p.Simple != nil && p.Simple.ErrorThreshold < 0 {
+			errs = append(errs, field.Invalid(path.Child("simple", "errorThreshold"), p.Simple.ErrorThreshold, "must be greater than or equal to 0"))
+		}
+		if p.Simple != nil && p.Simple.MaxErrors < 0 {
+			errs = append(errs, field.Invalid(path.Child("simple", "maxErrors"), p.Simple.MaxErrors, "must be greater than or equal to 0"))
+		}
+	case PolicyTypeEWMA:
+		if p.EWMA != nil && p.EWMA.DecayTime.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child("ewma", "decayTime"), p.EWMA.DecayTime.Duration.String(), "must be greater than or equal to 0"))
+		}
+		if p.EWMA != nil && (p.EWMA.Smoothing < 0 || p.EWMA.Smoothing > 1) {
+			errs = append(errs, field.Invalid(path.Child("ewma", "smoothing"), p.EWMA.Smoothing, "must be in the [0, 1] range"))
+		}
+		if p.EWMA != nil && p.EWMA.TargetLatency.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child("ewma", "targetLatency"), p.EWMA.TargetLatency.Duration.String(), "must be greater than or equal to 0"))
+		}
+		if p.EWMA != nil && (p.EWMA.MaxErrorRate < 0 || p.EWMA.MaxErrorRate > 1) {
+			errs = append(errs, field.Invalid(path.Child("ewma", "maxErrorRate"), p.EWMA.MaxErrorRate, "must be in the [0, 1] range"))
+		}
+		if p.EWMA != nil && (p.EWMA.RecoveryErrorRate < 0 || (p.EWMA.MaxErrorRate > 0 && p.EWMA.RecoveryErrorRate > p.EWMA.MaxErrorRate) || p.EWMA.RecoveryErrorRate > 1) {
+			errs = append(errs, field.Invalid(path.Child("ewma", "recoveryErrorRate"), p.EWMA.RecoveryErrorRate, "must be in the [0, maxErrorRate] range"))
+		}
+	case "":
+		errs = append(errs, field.Required(path.Child("type"), ""))
+	default:
+		errs = append(errs, field.NotSupported(path.Child("type"), p.Type, []string{PolicyTypeSimple, PolicyTypeEWMA}))
+	}
+	return errs
+}
+
+// policy builds the policy described by the config, the config must be valid
+func (p PolicyConfig) policy() EvaluateFunc {
+	switch p.Type {
+	case PolicyTypeSimple:
+		if p.Simple == nil {
+			return NewSimplePolicy(DefaultSimplePolicyConfig)
+		}
+		return NewSimplePolicy(*p.Simple)
+	case PolicyTypeEWMA:
+		if p.EWMA == nil {
+			return NewEWMAPolicy(DefaultEWMAPolicyConfig)
+		}
+		return NewEWMAPolicy(*p.EWMA)
+	}
+	return nil
+}
+
+// policyRules converts the policies to PolicyRule
+func (c *Config) policyRules() []PolicyRule {
+	rules := make([]PolicyRule, 0, len(c.Policies))
+	for _, policy := range c.Policies {
+		rules = append(rules, PolicyRule{Namespace: policy.Namespace, Service: policy.Service, Policy: policy.policy(), RequiresSamples: policy.Type == PolicyTypeEWMA})
+	}
+	return rules
+}
+
+// probeDefaults converts the prober settings to ProbeConfig
+func (c *Config) probeDefaults() ProbeConfig {
+	return ProbeConfig{Interval: c.Prober.Interval.Duration, Timeout: c.Prober.Timeout.Duration, JitterFactor: c.Prober.JitterFactor}
+}
+
+// Options returns the options that configure the detector according to the config, the config must be valid
+func (c *Config) Options() []Option {
+	return []Option{
+		WithWindowSize(c.WindowSize),
+		WithEndpointTTL(c.EndpointTTL.Duration),
+		WithWorkers(c.Workers),
+		WithChannelCapacity(c.ChannelCapacity),
+		WithMaxEjectionPercent(c.Ejection.MaxEjectionPercent),
+		WithProbeDefaults(c.probeDefaults()),
+		WithPolicies(c.policyRules()),
+	}
+}
+
+// NewFailureDetectorFromConfigFile creates a detector configured by the given file, the given options are applied afterwards.
+// While the detector is running the file is checked for changes every reloadInterval, a non-positive interval disables reloading.
+// Policies, the ejection cap and the prober settings (including for Services already being probed) are applied on reload, other changes require a restart,
+// an invalid file is reported and the current configuration is kept. Policies that don't fit the detector (see PolicyRule.RequiresSamples) make the file invalid
+func NewFailureDetectorFromConfigFile(path string, reloadInterval time.Duration, opts ...Option) (*failureDetector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %q: %v", path, err)
+	}
+
+	fd := newConfiguredFailureDetector(append(config.Options(), opts...)...)
+	if err := fd.removeInvalidPolicyRules(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %q: %v", path, err)
+	}
+	if reloadInterval > 0 {
+		fd.configReloader = &configReloader{path: path, interval: reloadInterval, data: data, config: config}
+	}
+	return fd, nil
+}
+
+// configReloader polls the configuration file for changes
+type configReloader struct {
+	path     string
+	interval time.Duration
+
+	// data and config hold the last applied configuration, they are accessed only by the reloader goroutine
+	data   []byte
+	config *Config
+}
+
+// run periodically calls the given function with a new configuration until the context is done,
+// the function returns the configuration that has actually been applied
+func (r *configReloader) run(ctx context.Context, applyFn func(current, updated *Config) *Config) {
+	wait.Until(func() {
+		data, err := os.ReadFile(r.path)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to reload configuration %q: %v", r.path, err))
+			return
+		}
+		if bytes.Equal(data, r.data) {
+			return
+		}
+		config, err := ParseConfig(data)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("ignoring invalid configuration %q: %v", r.path, err))
+			// don't report the same file again
+			r.data = data
+			return
+		}
+		r.data, r.config = data, applyFn(r.config, config)
+	}, r.interval, ctx.Done())
+}
+
+// reloadConfig applies the settings of the updated configuration that can be changed while the detector is running,
+// it returns the applied configuration which keeps the settings that require a restart from the current configuration
+func (fd *failureDetector) reloadConfig(current, updated *Config) *Config {
+	applied := *updated
+	if current.WindowSize != updated.WindowSize || current.EndpointTTL != updated.EndpointTTL || current.Workers != updated.Workers || current.ChannelCapacity != updated.ChannelCapacity {
+		utilruntime.HandleError(fmt.Errorf("changing windowSize, endpointTTL, workers or channelCapacity requires a restart, the new values are ignored"))
+		applied.WindowSize, applied.EndpointTTL, applied.Workers, applied.ChannelCapacity = current.WindowSize, current.EndpointTTL, current.Workers, current.ChannelCapacity
+	}
+	if !reflect.DeepEqual(current.Policies, updated.Policies) {
+		if err := fd.SetPolicies(updated.policyRules()); err != nil {
+			utilruntime.HandleError(fmt.Errorf("ignoring the policies of the configuration: %v", err))
+			applied.Policies = current.Policies
+		}
+	}
+	fd.SetMaxEjectionPercent(updated.Ejection.MaxEjectionPercent)
+	if current.Prober != updated.Prober {
+		fd.prober.setDefaults(updated.probeDefaults())
+	}
+	return &applied
+}
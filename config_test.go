@@ -0,0 +1,250 @@
+package failure_detector
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestParseConfig(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		content        string
+		expectedConfig *Config
+		expectedErrors []string
+	}{
+		{
+			name: "yaml",
+			content: `
+apiVersion: failuredetector/v1
+windowSize: 20
+endpointTTL: 2m
+workers: 2
+channelCapacity: 5000
+policies:
+- namespace: kube-system
+  service: etcd
+  type: simple
+  simple:
+    errorThreshold: 5
+    maxErrors: 20
+- namespace: kube-system
+  service: apiserver
+  type: ewma
+  ewma:
+    decayTime: 30s
+    targetLatency: 50ms
+- namespace: "*"
+  service: "*"
+  type: simple
+ejection:
+  maxEjectionPercent: 50
+prober:
+  interval: 5s
+  timeout: 500ms
+  jitterFactor: 0.2
+`,
+			expectedConfig: &Config{
+				APIVersion:      ConfigAPIVersion,
+				WindowSize:      20,
+				EndpointTTL:     metav1.Duration{Duration: 2 * time.Minute},
+				Workers:         2,
+				ChannelCapacity: 5000,
+				Policies: []PolicyConfig{
+					{Namespace: "kube-system", Service: "etcd", Type: PolicyTypeSimple, Simple: &SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 20}},
+					{Namespace: "kube-system", Service: "apiserver", Type: PolicyTypeEWMA, EWMA: &EWMAPolicyConfig{DecayTime: metav1.Duration{Duration: 30 * time.Second}, TargetLatency: metav1.Duration{Duration: 50 * time.Millisecond}}},
+					{Namespace: PolicyWildcard, Service: PolicyWildcard, Type: PolicyTypeSimple},
+				},
+				Ejection: EjectionConfig{MaxEjectionPercent: 50},
+				Prober:   ProberConfig{Interval: metav1.Duration{Duration: 5 * time.Second}, Timeout: metav1.Duration{Duration: 500 * time.Millisecond}, JitterFactor: 0.2},
+			},
+		},
+		{
+			name:           "json",
+			content:        `{"apiVersion": "failuredetector/v1", "windowSize": 5}`,
+			expectedConfig: &Config{APIVersion: ConfigAPIVersion, WindowSize: 5},
+		},
+		{
+			name:           "unknown field",
+			content:        "apiVersion: failuredetector/v1\nwindow: 5\n",
+			expectedErrors: []string{`unknown field "window"`},
+		},
+		{
+			name:           "missing version",
+			content:        "windowSize: 5\n",
+			expectedErrors: []string{"apiVersion: Required value"},
+		},
+		{
+			name:           "unsupported version",
+			content:        "apiVersion: failuredetector/v2\n",
+			expectedErrors: []string{`apiVersion: Unsupported value: "failuredetector/v2"`},
+		},
+		{
+			name: "all problems are reported",
+			content: `
+apiVersion: failuredetector/v1
+windowSize: -1
+endpointTTL: -1s
+policies:
+- namespace: ns
+  type: random
+- namespace: ns
+  service: etcd
+  type: simple
+  simple:
+    errorThreshold: -1
+- namespace: ns
+  service: etcd
+  type: simple
+- namespace: ns
+  service: apiserver
+  type: ewma
+  ewma:
+    smoothing: 2
+    maxErrorRate: 0.4
+    recoveryErrorRate: 0.6
+ejection:
+  maxEjectionPercent: 101
+prober:
+  jitterFactor: -1
+`,
+			expectedErrors: []string{
+				"windowSize: Invalid value: -1",
+				`endpointTTL: Invalid value: "-1s"`,
+				"policies[0].service: Required value",
+				`policies[0].type: Unsupported value: "random"`,
+				"policies[1].simple.errorThreshold: Invalid value: -1",
+				`policies[2]: Duplicate value: "ns/etcd"`,
+				"policies[3].ewma.smoothing: Invalid value: 2",
+				"policies[3].ewma.recoveryErrorRate: Invalid value: 0.6",
+				"ejection.maxEjectionPercent: Invalid value: 101",
+				"prober.jitterFactor: Invalid value: -1",
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			actualConfig, err := ParseConfig([]byte(scenario.content))
+			if len(scenario.expectedErrors) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(actualConfig, scenario.expectedConfig) {
+					t.Fatalf("expected %+v config but got %+v", scenario.expectedConfig, actualConfig)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, expectedError := range scenario.expectedErrors {
+				if !strings.Contains(err.Error(), expectedError) {
+					t.Errorf("expected %q in %q", expectedError, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestNewFailureDetectorFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("apiVersion: failuredetector/v1\nwindowSize: 20\nchannelCapacity: 10\nworkers: 2\n")
+
+	target, err := NewFailureDetectorFromConfigFile(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.windowSize != 20 || cap(target.processor.collectCh) != 10 || target.workers != 2 || target.endpointTTL != defaultEndpointTTL {
+		t.Fatalf("unexpected configuration: windowSize %d, channelCapacity %d, workers %d, endpointTTL %v", target.windowSize, cap(target.processor.collectCh), target.workers, target.endpointTTL)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go target.Run(ctx)
+
+	// an invalid file is ignored
+	writeConfig("apiVersion: failuredetector/v1\nejection:\n  maxEjectionPercent: 200\n")
+	time.Sleep(50 * time.Millisecond)
+	writeConfig(`
+apiVersion: failuredetector/v1
+windowSize: 20
+channelCapacity: 10
+workers: 2
+policies:
+- namespace: ns
+  service: etcd
+  type: simple
+ejection:
+  maxEjectionPercent: 50
+`)
+	err = wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		target.lock.Lock()
+		defer target.lock.Unlock()
+		return target.maxEjectionPercent == 50 && target.policies.get("ns", "etcd") != nil, nil
+	})
+	if err != nil {
+		t.Fatal("expected the configuration to be reloaded")
+	}
+
+	if _, err := NewFailureDetectorFromConfigFile(filepath.Join(t.TempDir(), "missing.yaml"), 0); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	// the EWMA policy needs individual samples, time-windowed detectors can't use it no matter the order of the options
+	writeConfig("apiVersion: failuredetector/v1\npolicies:\n- namespace: ns\n  service: etcd\n  type: ewma\n")
+	if _, err := NewFailureDetectorFromConfigFile(path, 0, WithTimeWindow(time.Minute, time.Second)); err == nil || !strings.Contains(err.Error(), "requires individual samples") {
+		t.Fatalf("expected the EWMA policy to be rejected, got %v", err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	current, err := ParseConfig([]byte("apiVersion: failuredetector/v1\nwindowSize: 20\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := NewDefaultFailureDetector(current.Options()...)
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	target.SetProbeTargets("ns", "etcd", ProbeConfig{Timeout: time.Second}, []*url.URL{endpoint})
+
+	updated, err := ParseConfig([]byte("apiVersion: failuredetector/v1\nwindowSize: 30\nprober:\n  interval: 1m\n  timeout: 5s\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := target.reloadConfig(current, updated)
+
+	// the window size requires a restart, the next reload must compare against the running value
+	if applied.WindowSize != 20 || applied.Prober != updated.Prober {
+		t.Fatalf("expected the applied configuration to keep the window size of 20 and take the new prober settings, got %d and %+v", applied.WindowSize, applied.Prober)
+	}
+
+	// the new defaults reach Services that are already probed but don't override their explicit settings
+	probeTarget := target.prober.targets[EndpointSampleToServiceKeyFunction(&EndpointSample{Namespace: "ns", Service: "etcd"})]
+	if probeTarget.config.Interval != time.Minute || probeTarget.config.Timeout != time.Second {
+		t.Fatalf("expected the interval of 1m and the timeout of 1s, got %v and %v", probeTarget.config.Interval, probeTarget.config.Timeout)
+	}
+
+	// policies that don't fit the detector are ignored and the next reload compares against the running ones
+	target = NewDefaultFailureDetector(append(current.Options(), WithTimeWindow(time.Minute, time.Second))...)
+	updated, err = ParseConfig([]byte("apiVersion: failuredetector/v1\nwindowSize: 20\npolicies:\n- namespace: ns\n  service: etcd\n  type: ewma\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied = target.reloadConfig(current, updated)
+	if len(applied.Policies) != 0 || target.policies.get("ns", "etcd") != nil {
+		t.Fatalf("expected the EWMA policy to be ignored, got %+v", applied.Policies)
+	}
+}
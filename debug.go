@@ -0,0 +1,124 @@
+package failure_detector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// Snapshot is a point-in-time copy of the data the detector holds, it is meant for debugging and incident reviews
+type Snapshot struct {
+	Time     time.Time         `json:"time"`
+	Services []SnapshotService `json:"services"`
+}
+
+// SnapshotService holds the endpoints of a single Service
+type SnapshotService struct {
+	Namespace string             `json:"namespace"`
+	Service   string             `json:"service"`
+	Endpoints []SnapshotEndpoint `json:"endpoints"`
+}
+
+// SnapshotEndpoint describes the status of a single endpoint as decided by the policy along with the recent transitions (oldest first),
+// see EndpointStatusDetails for the description of the fields
+type SnapshotEndpoint struct {
+	Key                string             `json:"key"`
+	URL                string             `json:"url"`
+	Status             string             `json:"status"`
+	Weight             float32            `json:"weight"`
+	Reason             string             `json:"reason,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastUpdate         time.Time          `json:"lastUpdate"`
+	LastTransitionTime time.Time          `json:"lastTransitionTime"`
+	Samples            int                `json:"samples"`
+	Errors             int                `json:"errors"`
+	Latency            LatencyPercentiles `json:"latency"`
+	History            []StatusTransition `json:"history,omitempty"`
+}
+
+// Snapshot returns a copy of the most recently published data ordered by Service and endpoint keys.
+// Unlike EndpointHealth it doesn't account for the conditions registered via SetEndpointsWithConditions.
+// It doesn't take the lock and is safe to call while the detector is running
+func (fd *failureDetector) Snapshot() Snapshot {
+	snapshot := Snapshot{Time: fd.clock.Now(), Services: []SnapshotService{}}
+	current := fd.readOnlyStore.Load()
+	if current == nil {
+		return snapshot
+	}
+
+	for name, published := range current.services {
+		service := published.snapshot.Load()
+		if service == nil {
+			continue
+		}
+		snapshotService := SnapshotService{Namespace: name.namespace, Service: name.service, Endpoints: make([]SnapshotEndpoint, 0, len(service.endpoints))}
+		for key, endpoint := range service.endpoints {
+			snapshotEndpoint := SnapshotEndpoint{
+				Key:                key,
+				Status:             endpoint.status,
+				Weight:             endpoint.weight,
+				Reason:             endpoint.reason,
+				Message:            endpoint.message,
+				LastUpdate:         endpoint.lastUpdate,
+				LastTransitionTime: endpoint.lastTransition,
+				Samples:            endpoint.decisionSamples,
+				Errors:             endpoint.decisionErrors,
+				Latency:            endpoint.latencyPercentiles,
+				History:            append([]StatusTransition(nil), endpoint.history...),
+			}
+			if endpoint.url != nil {
+				snapshotEndpoint.URL = endpoint.url.String()
+			}
+			snapshotService.Endpoints = append(snapshotService.Endpoints, snapshotEndpoint)
+		}
+		sort.Slice(snapshotService.Endpoints, func(i, j int) bool {
+			return snapshotService.Endpoints[i].Key < snapshotService.Endpoints[j].Key
+		})
+		snapshot.Services = append(snapshot.Services, snapshotService)
+	}
+	sort.Slice(snapshot.Services, func(i, j int) bool {
+		if snapshot.Services[i].Namespace != snapshot.Services[j].Namespace {
+			return snapshot.Services[i].Namespace < snapshot.Services[j].Namespace
+		}
+		return snapshot.Services[i].Service < snapshot.Services[j].Service
+	})
+	return snapshot
+}
+
+// DebugHandler returns an http.Handler that serves the Snapshot as JSON.
+// The optional "namespace" and "service" query parameters narrow down the Services included in the response
+func (fd *failureDetector) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		snapshot := fd.Snapshot()
+		namespace, service := req.URL.Query().Get("namespace"), req.URL.Query().Get("service")
+		if len(namespace) > 0 || len(service) > 0 {
+			services := []SnapshotService{}
+			for _, snapshotService := range snapshot.Services {
+				if len(namespace) > 0 && snapshotService.Namespace != namespace {
+					continue
+				}
+				if len(service) > 0 && snapshotService.Service != service {
+					continue
+				}
+				services = append(services, snapshotService)
+			}
+			snapshot.Services = services
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(snapshot); err != nil {
+			utilruntime.HandleError(err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package failure_detector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	otherEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	target := NewDefaultFailureDetector()
+	if snapshot := target.Snapshot(); len(snapshot.Services) != 0 {
+		t.Fatalf("expected an empty snapshot, got %+v", snapshot)
+	}
+
+	for _, endpointSample := range append(genSamples(otherEndpoint, 10, true), genSamples(endpoint, 100, true)...) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	for _, endpointSample := range genSamples(endpoint, 10, true) {
+		endpointSample.Namespace = "other"
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+
+	snapshot := target.Snapshot()
+	if len(snapshot.Services) != 2 || snapshot.Services[0].Namespace != "ns" || snapshot.Services[1].Namespace != "other" {
+		t.Fatalf("expected two Services ordered by namespace, got %+v", snapshot.Services)
+	}
+	endpoints := snapshot.Services[0].Endpoints
+	if len(endpoints) != 2 || endpoints[0].Key != endpoint.Host || endpoints[1].Key != otherEndpoint.Host {
+		t.Fatalf("expected two endpoints ordered by key, got %+v", endpoints)
+	}
+	if endpoints[0].URL != endpoint.String() || endpoints[0].Status != EndpointStatusReasonTooManyErrors || endpoints[0].Samples != 10 || endpoints[0].Errors != 10 || len(endpoints[0].History) != 10 {
+		t.Fatalf("unexpected endpoint %+v", endpoints[0])
+	}
+
+	// the snapshot is a copy
+	endpoints[0].History[0].Reason = "Modified"
+	if target.Snapshot().Services[0].Endpoints[0].History[0].Reason == "Modified" {
+		t.Fatal("modifying the snapshot must not affect the detector")
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	target := NewDefaultFailureDetector()
+	for _, endpointSample := range genSamples(&url.URL{Scheme: "https", Host: "1.1.1.1:6443"}, 10, true) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+
+	scenarios := []struct {
+		name             string
+		method           string
+		query            string
+		expectedCode     int
+		expectedServices int
+	}{
+		{name: "all Services", method: http.MethodGet, expectedCode: http.StatusOK, expectedServices: 1},
+		{name: "matching Service", method: http.MethodGet, query: "?namespace=ns&service=etcd", expectedCode: http.StatusOK, expectedServices: 1},
+		{name: "other namespace", method: http.MethodGet, query: "?namespace=other", expectedCode: http.StatusOK},
+		{name: "other Service", method: http.MethodGet, query: "?service=other", expectedCode: http.StatusOK},
+		{name: "unsupported method", method: http.MethodPost, expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			target.DebugHandler().ServeHTTP(recorder, httptest.NewRequest(scenario.method, "/debug/failure-detector"+scenario.query, nil))
+			if recorder.Code != scenario.expectedCode {
+				t.Fatalf("expected %d status code but got %d", scenario.expectedCode, recorder.Code)
+			}
+			if scenario.expectedCode != http.StatusOK {
+				return
+			}
+
+			snapshot := Snapshot{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &snapshot); err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshot.Services) != scenario.expectedServices {
+				t.Fatalf("expected %d Services but got %+v", scenario.expectedServices, snapshot.Services)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// EndpointStatusDetails describes the current status of an endpoint along with the decision behind it,
+// it is meant for explaining why an endpoint has been skipped (e.g. in logs or error pages)
+type EndpointStatusDetails struct {
+	// Health the health of the endpoint, see EndpointHealth
+	Health EndpointHealth
+
+	// Status an empty status means the endpoint is considered healthy otherwise it holds the reason the endpoint is considered unhealthy
+	// (e.g. EndpointStatusReasonTooManyErrors or EndpointStatusReasonNotReady)
+	Status string
+
+	// Weight is a number in the [0, 1] range
+	Weight float32
+
+	// Reason a short, CamelCase identifier of the last decision, see PolicyResult.Reason
+	Reason string
+
+	// Message a human-readable description of the last decision, for example "10 of last 10 requests failed: connection refused"
+	Message string
+
+	// LastTransitionTime the time the status last changed, it is zero when the status hasn't changed since the detector started tracking the endpoint
+	LastTransitionTime time.Time
+
+	// Samples the number of requests the last decision was based on, samples that survived thinning (see SetSamplingRate) stand for more than one request
+	Samples int
+
+	// Errors the number of requests out of Samples that failed
+	Errors int
+
+	// Latency holds latency percentiles of the recent requests, it is refreshed at most once a second unless the status or the weight changes
+	Latency LatencyPercentiles
+}
+
+// String returns a one-line description of the details, for example "Unhealthy (TooManyErrors): 10 of last 10 requests failed: connection refused"
+func (d EndpointStatusDetails) String() string {
+	description := string(d.Health)
+	if len(d.Reason) > 0 {
+		description = fmt.Sprintf("%s (%s)", description, d.Reason)
+	}
+	if len(d.Message) > 0 {
+		description = fmt.Sprintf("%s: %s", description, d.Message)
+	}
+	return description
+}
+
+// EndpointStatusDetails returns the current status of the given endpoint for the given Service along with the decision behind it.
+// Like EndpointHealth it reports EndpointUnknown for endpoints without data and endpoints that haven't been registered for the Service
+func (fd *failureDetector) EndpointStatusDetails(namespace, service string, url *url.URL) EndpointStatusDetails {
+	return fd.Lookup(namespace, service).EndpointStatusDetails(url)
+}
+
+// EndpointStatusDetails returns the current status of the given endpoint along with the decision behind it, see failureDetector.EndpointStatusDetails
+func (v ServiceView) EndpointStatusDetails(url *url.URL) EndpointStatusDetails {
+	return v.EndpointStatusDetailsWithID(url, "")
+}
+
+// EndpointStatusDetailsWithID works like EndpointStatusDetails for detectors that identify endpoints by EndpointSample.EndpointID
+func (v ServiceView) EndpointStatusDetailsWithID(url *url.URL, endpointID string) EndpointStatusDetails {
+	endpointKey := v.fd.endpointKeyFn(url, endpointID)
+	registeredEndpoint, hasService := v.fd.registry.get(v.name.namespace, v.name.service, endpointKey)
+	if hasService && registeredEndpoint == nil {
+		return EndpointStatusDetails{Health: EndpointUnknown, Weight: 1.0, Message: "the endpoint isn't registered for the Service"}
+	}
+	if registeredEndpoint != nil {
+		if reason := registeredEndpoint.conditionsReason(); len(reason) > 0 {
+			return EndpointStatusDetails{Health: EndpointUnhealthy, Status: reason, Reason: reason, Message: fmt.Sprintf("the endpoint has been registered as %s", reason)}
+		}
+	}
+
+	endpoint := v.endpoint(endpointKey)
+	if endpoint == nil {
+		return EndpointStatusDetails{Health: EndpointUnknown, Weight: 1.0, Message: "no samples have been collected for the endpoint"}
+	}
+
+	details := EndpointStatusDetails{
+		Health:             EndpointHealthy,
+		Status:             endpoint.status,
+		Weight:             endpoint.weight,
+		Reason:             endpoint.reason,
+		Message:            endpoint.message,
+		LastTransitionTime: endpoint.lastTransition,
+		Samples:            endpoint.decisionSamples,
+		Errors:             endpoint.decisionErrors,
+		Latency:            endpoint.latencyPercentiles,
+	}
+	if len(endpoint.status) > 0 {
+		details.Health = EndpointUnhealthy
+	}
+	return details
+}
+
+// describeSamples returns a human-readable summary of the samples collected for the given endpoint, policies use it as PolicyResult.Explanation
+func describeSamples(endpoint *WeightedEndpointStatus) string {
+	requests, errors, lastErr := endpoint.countSamples()
+	description := fmt.Sprintf("%d of last %d requests failed", errors, requests)
+	if endpoint.window != nil {
+		description = fmt.Sprintf("%d of %d requests in the last %v failed", errors, requests, endpoint.window.window())
+	}
+	if lastErr != nil {
+		description = fmt.Sprintf("%s: %v", description, lastErr)
+	}
+	return description
+}
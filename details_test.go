@@ -0,0 +1,124 @@
+package failure_detector
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestEndpointStatusDetails(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	otherEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+
+	scenarios := []struct {
+		name            string
+		options         []Option
+		registered      []RegisteredEndpoint
+		samples         []*EndpointSample
+		laterSamples    []*EndpointSample
+		expectedDetails EndpointStatusDetails
+	}{
+		{
+			name:            "no data",
+			expectedDetails: EndpointStatusDetails{Health: EndpointUnknown, Weight: 1, Message: "no samples have been collected for the endpoint"},
+		},
+		{
+			name:            "not registered for the Service",
+			registered:      []RegisteredEndpoint{{URL: otherEndpoint, Ready: true}},
+			expectedDetails: EndpointStatusDetails{Health: EndpointUnknown, Weight: 1, Message: "the endpoint isn't registered for the Service"},
+		},
+		{
+			name:            "registered as not ready",
+			registered:      []RegisteredEndpoint{{URL: endpoint}},
+			expectedDetails: EndpointStatusDetails{Health: EndpointUnhealthy, Status: EndpointStatusReasonNotReady, Reason: EndpointStatusReasonNotReady, Message: "the endpoint has been registered as NotReady"},
+		},
+		{
+			name:    "decreased weight",
+			samples: genSamples(endpoint, 10, true),
+			expectedDetails: EndpointStatusDetails{
+				Health:  EndpointHealthy,
+				Weight:  1 - 1/float32(100)*float32(10),
+				Reason:  SimplePolicyReasonErrorCountChanged,
+				Message: "10 of last 10 requests failed: error 9",
+				Samples: 10,
+				Errors:  10,
+			},
+		},
+		{
+			name:    "ejected",
+			samples: genSamples(endpoint, 100, true),
+			expectedDetails: EndpointStatusDetails{
+				Health:             EndpointUnhealthy,
+				Status:             EndpointStatusReasonTooManyErrors,
+				Reason:             EndpointStatusReasonTooManyErrors,
+				Message:            "10 of last 10 requests failed: error 99",
+				LastTransitionTime: now,
+				Samples:            10,
+				Errors:             10,
+			},
+		},
+		{
+			name:         "recovering",
+			samples:      genSamples(endpoint, 100, true),
+			laterSamples: genSamples(endpoint, 10, false),
+			expectedDetails: EndpointStatusDetails{
+				Health:             EndpointHealthy,
+				Weight:             1 - 1/float32(100)*float32(90),
+				Reason:             SimplePolicyReasonErrorCountChanged,
+				Message:            "0 of last 10 requests failed",
+				LastTransitionTime: later,
+				Samples:            10,
+			},
+		},
+		{
+			name:         "not ejected because of the cap",
+			options:      []Option{WithMaxEjectionPercent(50)},
+			samples:      genSamples(otherEndpoint, 100, true),
+			laterSamples: genSamples(endpoint, 100, true),
+			expectedDetails: EndpointStatusDetails{
+				Health:  EndpointHealthy,
+				Reason:  PolicyReasonMaxEjectionPercent,
+				Message: "not ejected because the max ejection percent has been reached, 10 of last 10 requests failed: error 99",
+				Samples: 10,
+				Errors:  10,
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock(now)
+			target := NewDefaultFailureDetector(scenario.options...)
+			target.clock = fakeClock
+			if len(scenario.registered) > 0 {
+				target.SetEndpointsWithConditions("ns", "etcd", scenario.registered)
+			}
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+			fakeClock.SetTime(later)
+			for _, endpointSample := range scenario.laterSamples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			actualDetails := target.EndpointStatusDetails("ns", "etcd", endpoint)
+			if actualDetails != scenario.expectedDetails {
+				t.Fatalf("expected %+v but got %+v", scenario.expectedDetails, actualDetails)
+			}
+		})
+	}
+}
+
+func TestEndpointStatusDetailsString(t *testing.T) {
+	details := EndpointStatusDetails{Health: EndpointUnhealthy, Reason: EndpointStatusReasonTooManyErrors, Message: "10 of last 10 requests failed: connection refused"}
+	if expected := "Unhealthy (TooManyErrors): 10 of last 10 requests failed: connection refused"; details.String() != expected {
+		t.Fatalf("expected %q but got %q", expected, details.String())
+	}
+	if expected := "Unknown"; (EndpointStatusDetails{Health: EndpointUnknown}).String() != expected {
+		t.Fatalf("expected %q", expected)
+	}
+}
@@ -0,0 +1,34 @@
+package failure_detector
+
+// PolicyReasonMaxEjectionPercent means the policy decided to eject the endpoint but the cap set by SetMaxEjectionPercent has been reached
+const PolicyReasonMaxEjectionPercent = "MaxEjectionPercentReached"
+
+// SetMaxEjectionPercent caps the percentage of endpoints of a Service that can be ejected at the same time, 0 disables the cap.
+// Like in Envoy at least one endpoint can always be ejected. Endpoints that would exceed the cap keep the weight computed by the policy
+// but they aren't ejected, the cap doesn't affect endpoints that have already been ejected.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetMaxEjectionPercent(percent int) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+	fd.maxEjectionPercent = percent
+}
+
+// canEject returns true if one more endpoint of the given Service can be ejected, must be called with fd.lock held
+func (fd *failureDetector) canEject(endpointsStore *WeightedEndpointStatusStore) bool {
+	if fd.maxEjectionPercent <= 0 || fd.maxEjectionPercent >= 100 {
+		return true
+	}
+
+	endpoints := endpointsStore.List()
+	ejected := 0
+	for _, endpoint := range endpoints {
+		if len(endpoint.status) > 0 {
+			ejected++
+		}
+	}
+	maxEjected := len(endpoints) * fd.maxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	return ejected < maxEjected
+}
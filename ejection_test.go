@@ -0,0 +1,50 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestMaxEjectionPercent(t *testing.T) {
+	scenarios := []struct {
+		name               string
+		maxEjectionPercent int
+		endpoints          int
+		expectedEjected    int
+	}{
+		{name: "no cap", endpoints: 4, expectedEjected: 4},
+		{name: "half of the endpoints", maxEjectionPercent: 50, endpoints: 4, expectedEjected: 2},
+		{name: "at least one endpoint", maxEjectionPercent: 10, endpoints: 4, expectedEjected: 1},
+		{name: "all endpoints", maxEjectionPercent: 100, endpoints: 4, expectedEjected: 4},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewDefaultFailureDetector(WithMaxEjectionPercent(scenario.maxEjectionPercent))
+			endpoints := []*url.URL{}
+			for i := 0; i < scenario.endpoints; i++ {
+				endpoints = append(endpoints, &url.URL{Scheme: "https", Host: fmt.Sprintf("10.0.0.%d:443", i)})
+			}
+			for _, endpoint := range endpoints {
+				for _, endpointSample := range genSamples(endpoint, 100, true) {
+					target.processBatch([]*EndpointSample{endpointSample})
+				}
+			}
+
+			actualEjected := 0
+			for _, endpoint := range endpoints {
+				isHealthy, weight := target.EndpointStatus("ns", "etcd", endpoint)
+				if !isHealthy {
+					actualEjected++
+				}
+				if weight != 0 {
+					t.Fatalf("expected the weight of %v to be computed by the policy, got %v", endpoint, weight)
+				}
+			}
+			if actualEjected != scenario.expectedEjected {
+				t.Fatalf("expected %d ejected endpoints but got %d", scenario.expectedEjected, actualEjected)
+			}
+		})
+	}
+}
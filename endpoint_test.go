@@ -3,6 +3,7 @@ package failure_detector
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
 	"testing"
 )
@@ -87,3 +88,39 @@ func TestEndpointType(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointKeyFunctions(t *testing.T) {
+	mustParse := func(rawURL string) *url.URL {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	scenarios := []struct {
+		name        string
+		keyFn       EndpointKeyFunc
+		url         *url.URL
+		endpointID  string
+		expectedKey string
+	}{
+		{name: "host", keyFn: HostEndpointKey, url: mustParse("https://10.0.0.1:443/api"), expectedKey: "10.0.0.1:443"},
+		{name: "host without a URL", keyFn: HostEndpointKey, endpointID: "id"},
+		{name: "scheme and host", keyFn: SchemeHostEndpointKey, url: mustParse("http://10.0.0.1/api"), expectedKey: "http://10.0.0.1"},
+		{name: "scheme and host without a host", keyFn: SchemeHostEndpointKey, url: mustParse("/api")},
+		{name: "host and path prefix", keyFn: HostPathPrefixEndpointKey(1), url: mustParse("https://10.0.0.1/api/v1/pods"), expectedKey: "10.0.0.1/api"},
+		{name: "host and a longer path prefix", keyFn: HostPathPrefixEndpointKey(2), url: mustParse("https://10.0.0.1/api/v1/pods"), expectedKey: "10.0.0.1/api/v1"},
+		{name: "host and a path shorter than the prefix", keyFn: HostPathPrefixEndpointKey(3), url: mustParse("https://10.0.0.1/api"), expectedKey: "10.0.0.1/api"},
+		{name: "host and an empty path", keyFn: HostPathPrefixEndpointKey(1), url: mustParse("https://10.0.0.1"), expectedKey: "10.0.0.1"},
+		{name: "endpoint ID", keyFn: EndpointIDKey, url: mustParse("https://10.0.0.1"), endpointID: "pod-a", expectedKey: "pod-a"},
+		{name: "missing endpoint ID", keyFn: EndpointIDKey, url: mustParse("https://10.0.0.1")},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if actualKey := scenario.keyFn(scenario.url, scenario.endpointID); actualKey != scenario.expectedKey {
+				t.Fatalf("expected %q key but got %q", scenario.expectedKey, actualKey)
+			}
+		})
+	}
+}
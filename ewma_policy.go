@@ -0,0 +1,192 @@
+package failure_detector
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EWMAPolicyReasonScoreChanged means the EWMA policy changed the weight of a healthy endpoint
+	EWMAPolicyReasonScoreChanged = "ScoreChanged"
+
+	// EWMAPolicyReasonTimeWindowUnsupported means the EWMA policy assessed a time-windowed endpoint, it needs individual samples and keeps the current status and weight
+	EWMAPolicyReasonTimeWindowUnsupported = "TimeWindowUnsupported"
+)
+
+// ewmaMinWeightChange is the smallest change of the weight the EWMA policy publishes, except for reaching 0 or 1.
+// It keeps the policy from republishing endpoints whose averages move only slightly with every batch
+const ewmaMinWeightChange = 0.05
+
+// EWMAPolicyConfig parameterizes the policy returned by NewEWMAPolicy
+type EWMAPolicyConfig struct {
+	// DecayTime the time after which an observation counts about 1/e as much as a new one
+	DecayTime metav1.Duration `json:"decayTime,omitempty"`
+
+	// Smoothing the minimal fraction by which a single request moves the averages, it must be in the (0, 1] range.
+	// It makes requests observed at (nearly) the same time count
+	Smoothing float64 `json:"smoothing,omitempty"`
+
+	// TargetLatency endpoints with the latency average at or below the target aren't penalized, slower endpoints get TargetLatency/latency of the weight
+	TargetLatency metav1.Duration `json:"targetLatency,omitempty"`
+
+	// MaxErrorRate the error rate average at which the endpoint is ejected (EndpointStatusReasonTooManyErrors), it must be in the (0, 1] range
+	MaxErrorRate float64 `json:"maxErrorRate,omitempty"`
+
+	// RecoveryErrorRate the error rate average at or below which an ejected endpoint is considered healthy again, it must be in the (0, MaxErrorRate] range.
+	// Half of MaxErrorRate is used when not set so that endpoints with the error rate around MaxErrorRate don't flap
+	RecoveryErrorRate float64 `json:"recoveryErrorRate,omitempty"`
+}
+
+// DefaultEWMAPolicyConfig is used for parameters of EWMAPolicyConfig that aren't set
+var DefaultEWMAPolicyConfig = EWMAPolicyConfig{
+	DecayTime:         metav1.Duration{Duration: 10 * time.Second},
+	Smoothing:         0.1,
+	TargetLatency:     metav1.Duration{Duration: 100 * time.Millisecond},
+	MaxErrorRate:      0.5,
+	RecoveryErrorRate: 0.25,
+}
+
+// NewEWMAPolicy returns a policy that keeps exponentially weighted moving averages of the error rate and the latency of every endpoint
+// and sets the weight to the success rate times the inverse of the latency relative to TargetLatency, rounded to 0.001.
+// The weight is changed only when it moves by at least 0.05 or reaches 0 or 1, an endpoint is ejected at MaxErrorRate and recovers at RecoveryErrorRate.
+// The latency average follows spikes immediately and decays slowly (peak EWMA) so that slow endpoints lose traffic quickly.
+// The averages are kept in PolicyResult.State, thus the policy needs individual samples: rules using it must set PolicyRule.RequiresSamples (see NewEWMAPolicyRule)
+// so that time-windowed detectors (see WithTimeWindow) reject them, on time-windowed endpoints the policy keeps the current status and weight.
+// Non-positive parameters are replaced with the defaults (DefaultEWMAPolicyConfig)
+func NewEWMAPolicy(config EWMAPolicyConfig) EvaluateFunc {
+	if config.DecayTime.Duration <= 0 {
+		config.DecayTime = DefaultEWMAPolicyConfig.DecayTime
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = DefaultEWMAPolicyConfig.Smoothing
+	}
+	if config.TargetLatency.Duration <= 0 {
+		config.TargetLatency = DefaultEWMAPolicyConfig.TargetLatency
+	}
+	if config.MaxErrorRate <= 0 || config.MaxErrorRate > 1 {
+		config.MaxErrorRate = DefaultEWMAPolicyConfig.MaxErrorRate
+	}
+	if config.RecoveryErrorRate <= 0 || config.RecoveryErrorRate > config.MaxErrorRate {
+		config.RecoveryErrorRate = config.MaxErrorRate / 2
+	}
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return evaluateEWMAPolicy(endpoint, config)
+	}
+}
+
+// NewEWMAPolicyRule returns a rule that assigns NewEWMAPolicy with the given config to the matching Services, the rule is marked with PolicyRule.RequiresSamples
+func NewEWMAPolicyRule(namespace, service string, config EWMAPolicyConfig) PolicyRule {
+	return PolicyRule{Namespace: namespace, Service: service, Policy: NewEWMAPolicy(config), RequiresSamples: true}
+}
+
+// ewmaState holds the moving averages of a single endpoint
+type ewmaState struct {
+	initialized bool
+	errorRate   float64
+	latency     float64
+
+	// lastObservation is the time of the most recent sample
+	lastObservation time.Time
+
+	// seen is WeightedEndpointStatus.AddedSamples when the averages were last updated
+	seen uint64
+
+	// ejected and weight hold the last decision of the policy
+	ejected bool
+	weight  float32
+}
+
+// observe updates the averages with the given sample
+func (s *ewmaState) observe(sample *Sample, config EWMAPolicyConfig) {
+	// the weight of the averages so far, the first sample replaces them
+	decay := 0.0
+	if s.initialized {
+		elapsed := sample.timestamp.Sub(s.lastObservation)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		decay = math.Pow(1-config.Smoothing, sample.requestCount()) * math.Exp(-float64(elapsed)/float64(config.DecayTime.Duration))
+	}
+	if sample.timestamp.After(s.lastObservation) {
+		s.lastObservation = sample.timestamp
+	}
+
+	failed := 0.0
+	if sample.err != nil {
+		failed = 1
+	}
+	s.errorRate = s.errorRate*decay + failed*(1-decay)
+
+	if latency := float64(sample.latency); latency > 0 {
+		if latency > s.latency {
+			s.latency = latency
+		} else {
+			s.latency = s.latency*decay + latency*(1-decay)
+		}
+	}
+	s.initialized = true
+}
+
+func evaluateEWMAPolicy(endpoint *WeightedEndpointStatus, config EWMAPolicyConfig) PolicyResult {
+	state, ok := endpoint.policyState.(ewmaState)
+	if !ok {
+		state.ejected = endpoint.status == EndpointStatusReasonTooManyErrors
+		state.weight = endpoint.weight
+	}
+	result := endpoint.current()
+	if endpoint.window != nil {
+		result.State = state
+		result.Reason = EWMAPolicyReasonTimeWindowUnsupported
+		result.Explanation = "the policy needs individual samples, it doesn't support time-windowed endpoints"
+		return result
+	}
+
+	samples := endpoint.Get()
+	if unseen := endpoint.addedSamples - state.seen; unseen < uint64(len(samples)) {
+		samples = samples[len(samples)-int(unseen):]
+	}
+	for _, sample := range samples {
+		state.observe(sample, config)
+	}
+	state.seen = endpoint.addedSamples
+	result.State = state
+	if !state.initialized {
+		return result
+	}
+
+	latencyFactor := 1.0
+	if target := float64(config.TargetLatency.Duration); state.latency > target {
+		latencyFactor = target / state.latency
+	}
+	weight := float32(math.Round((1-state.errorRate)*latencyFactor*1000) / 1000)
+	ejected := state.errorRate >= config.MaxErrorRate
+	if state.ejected {
+		ejected = state.errorRate > config.RecoveryErrorRate
+	}
+	weightChanged := math.Abs(float64(weight-state.weight)) >= ewmaMinWeightChange || (weight != state.weight && (weight == 0 || weight == 1))
+	if !weightChanged {
+		weight = state.weight
+	}
+	state.ejected, state.weight = ejected, weight
+	result.State = state
+
+	status := ""
+	if ejected {
+		status = EndpointStatusReasonTooManyErrors
+	}
+	if weight == endpoint.weight && status == endpoint.status {
+		return result
+	}
+
+	result.Weight = weight
+	result.Status = status
+	result.Reason = EWMAPolicyReasonScoreChanged
+	if len(status) > 0 {
+		result.Reason = status
+	}
+	result.Explanation = fmt.Sprintf("error rate %.1f%%, latency %v", state.errorRate*100, time.Duration(state.latency).Round(time.Microsecond))
+	return result
+}
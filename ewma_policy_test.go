@@ -0,0 +1,150 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestEWMAPolicy(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	samplesOf := func(number int, failed bool, latency time.Duration) []*EndpointSample {
+		samples := genSamples(endpoint, number, failed)
+		for _, endpointSample := range samples {
+			endpointSample.Latency = latency
+		}
+		return samples
+	}
+	config := EWMAPolicyConfig{
+		DecayTime:     metav1.Duration{Duration: 10 * time.Second},
+		Smoothing:     0.5,
+		TargetLatency: metav1.Duration{Duration: 100 * time.Millisecond},
+		MaxErrorRate:  0.5,
+	}
+
+	type step struct {
+		after           time.Duration
+		samples         []*EndpointSample
+		expectedStatus  string
+		expectedWeight  float32
+		expectedMessage string
+	}
+	scenarios := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "fast endpoint without errors",
+			steps: []step{
+				{samples: samplesOf(5, false, 10*time.Millisecond), expectedWeight: 1},
+			},
+		},
+		{
+			name: "errors decrease the weight continuously",
+			steps: []step{
+				{samples: samplesOf(1, false, 0), expectedWeight: 1},
+				{samples: samplesOf(1, true, 0), expectedWeight: 0.5, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 50.0%, latency 0s"},
+				{samples: samplesOf(1, false, 0), expectedWeight: 0.75, expectedMessage: "error rate 25.0%, latency 0s"},
+				{samples: samplesOf(1, false, 0), expectedWeight: 0.875, expectedMessage: "error rate 12.5%, latency 0s"},
+			},
+		},
+		{
+			name: "latency spikes are followed immediately and decay slowly",
+			steps: []step{
+				{samples: samplesOf(1, false, 50*time.Millisecond), expectedWeight: 1},
+				{samples: samplesOf(1, false, 400*time.Millisecond), expectedWeight: 0.25, expectedMessage: "error rate 0.0%, latency 400ms"},
+				{samples: samplesOf(1, false, 100*time.Millisecond), expectedWeight: 0.4, expectedMessage: "error rate 0.0%, latency 250ms"},
+			},
+		},
+		{
+			name: "an ejected endpoint recovers only at the recovery error rate",
+			steps: []step{
+				{samples: samplesOf(1, true, 0), expectedWeight: 0, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 100.0%, latency 0s"},
+				{samples: samplesOf(1, false, 0), expectedWeight: 0.5, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 50.0%, latency 0s"},
+				{samples: samplesOf(1, true, 0), expectedWeight: 0.25, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 75.0%, latency 0s"},
+				// below MaxErrorRate but above RecoveryErrorRate (half of MaxErrorRate)
+				{samples: samplesOf(1, false, 0), expectedWeight: 0.625, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 37.5%, latency 0s"},
+				{samples: samplesOf(1, false, 0), expectedWeight: 0.813, expectedMessage: "error rate 18.8%, latency 0s"},
+			},
+		},
+		{
+			name: "small changes of the weight aren't published",
+			steps: []step{
+				{samples: samplesOf(1, false, 100*time.Millisecond), expectedWeight: 1},
+				{samples: samplesOf(1, false, 104*time.Millisecond), expectedWeight: 1},
+				{samples: samplesOf(1, false, 120*time.Millisecond), expectedWeight: 0.833, expectedMessage: "error rate 0.0%, latency 120ms"},
+			},
+		},
+		{
+			name: "old observations decay with time",
+			steps: []step{
+				{samples: samplesOf(1, true, 0), expectedWeight: 0, expectedStatus: EndpointStatusReasonTooManyErrors, expectedMessage: "error rate 100.0%, latency 0s"},
+				// after 10 decay times the previous error rate is negligible
+				{after: 100 * time.Second, samples: samplesOf(1, false, 0), expectedWeight: 1, expectedMessage: "error rate 0.0%, latency 0s"},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock(now)
+			target := NewDefaultFailureDetector(WithClock(fakeClock), WithEndpointTTL(time.Hour))
+			if err := target.SetPolicy(NewEWMAPolicyRule("ns", "etcd", config)); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, step := range scenario.steps {
+				fakeClock.Step(step.after)
+				target.processBatch(step.samples)
+
+				details := target.EndpointStatusDetails("ns", "etcd", endpoint)
+				if details.Health == EndpointUnknown {
+					// unchanged endpoints aren't published
+					details.Message = ""
+				}
+				if details.Status != step.expectedStatus || details.Weight != step.expectedWeight || details.Message != step.expectedMessage {
+					t.Fatalf("step %d: expected %q status, %v weight and %q message but got %q, %v and %q", i, step.expectedStatus, step.expectedWeight, step.expectedMessage, details.Status, details.Weight, details.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestEWMAPolicyInCombinators(t *testing.T) {
+	unhealthy := func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return PolicyResult{Status: EndpointStatusReasonTooManyErrors, Weight: 0.1}
+	}
+	endpoint := newWeightedEndpoint(defaultWindowSize, nil)
+	policy := AllOf(unhealthy, NewEWMAPolicy(DefaultEWMAPolicyConfig))
+
+	endpoint.Add(&Sample{})
+	endpoint.apply(policy(endpoint))
+	for i := 0; i < 9; i++ {
+		endpoint.Add(&Sample{err: fmt.Errorf("error %d", i)})
+		endpoint.apply(policy(endpoint))
+	}
+
+	// every error moves the error rate by 10% of the remaining distance, 0.9^9 of the weight is left
+	if expected := float32(0.387); endpoint.weight != expected {
+		t.Fatalf("expected the weight of %v but got %v", expected, endpoint.weight)
+	}
+	states, ok := endpoint.PolicyState().(combinedPolicyState)
+	if !ok || len(states) != 2 || states[0] != nil || states[1].(ewmaState).seen != 10 {
+		t.Fatalf("expected the state of the EWMA policy to be kept, got %#v", endpoint.PolicyState())
+	}
+}
+
+func TestEWMAPolicyWithTimeWindow(t *testing.T) {
+	endpoint := newTimeWindowedEndpoint(time.Minute, time.Second, nil)
+	endpoint.Add(&Sample{err: fmt.Errorf("error")})
+
+	result := NewEWMAPolicy(DefaultEWMAPolicyConfig)(endpoint)
+	if result.Reason != EWMAPolicyReasonTimeWindowUnsupported || result.Weight != endpoint.weight || len(result.Status) > 0 {
+		t.Fatalf("expected the policy to keep the current status and weight and report %q, got %+v", EWMAPolicyReasonTimeWindowUnsupported, result)
+	}
+}
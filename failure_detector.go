@@ -2,57 +2,280 @@ package failure_detector
 
 import (
 	"context"
+	"fmt"
 	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	batchqueue "github.com/p0lyn0mial/batch-working-queue"
-	ttlstore "github.com/p0lyn0mial/ttl-cache"
-
 	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // failureDetector is receiving endpoint samples and maintains endpoint status according to logic implemented by a policy evaluator
 type failureDetector struct {
+	// processedSamples counts samples passed to processBatch, must be accessed atomically
+	// it is kept first so that it is 64-bit aligned on 32-bit platforms
+	processedSamples uint64
+
+	// evictedEndpoints counts endpoints evicted because of the configured limits, must be accessed atomically
+	evictedEndpoints uint64
+
+	// rejectedSamples counts samples rejected as invalid, must be accessed atomically
+	rejectedSamples uint64
+
 	// endpointSampleKeyFn maps collected sample (EndpointSample) for a Service to the internal store
 	endpointSampleKeyFn KeyFunc
 
+	// endpointKeyFn identifies endpoints within a Service
+	endpointKeyFn EndpointKeyFunc
+
 	//processor retrieves EndpointSamples from the exposed channel and calls out to processBatch() function for processing
 	processor *processor
 
-	// store holds WeightedEndpointStatusStore (samples) per Service (Namespace/Service)
-	store map[string]WeightedEndpointStatusStore
+	// lock protects the store, it is held by the worker while processing a batch
+	// and by writers that modify the store outside of the worker (i.e. SetEndpoints)
+	lock sync.Mutex
+
+	// store holds WeightedEndpointStatusStore (samples) per Service ordered by the time they were last updated
+	store *Store[serviceName, *WeightedEndpointStatusStore]
+
+	// trackedEndpoints the number of endpoints held by the store
+	trackedEndpoints int
+
+	// limits bounds the size of the store
+	limits Limits
+
+	// evictionFn an optional function notified when an endpoint is evicted because of the limits
+	evictionFn EvictionFunc
 
 	// readOnlyStore holds a copy of the store that is safe for concurrent (read) access
-	readOnlyStore atomic.Value
+	readOnlyStore atomic.Pointer[storeSnapshot]
 
 	// createStoreFn a helper function for creating the WeightedEndpointStatusStore store
 	createStoreFn NewStoreFunc
 
-	// policyEvaluatorFn an external policy function for assessing the endpoints
+	// policyEvaluatorFn an external policy function for assessing the endpoints of Services that don't match any of the policies
 	policyEvaluatorFn EvaluateFunc
+
+	// policies holds policies assigned to Services via SetPolicy
+	policies *policies
+
+	// samplingRates holds per-Service rates used for thinning successful samples passed to Record
+	samplingRates *samplingRates
+
+	// prober periodically probes registered endpoints, the results are recorded as active samples
+	prober *prober
+
+	// registry holds endpoints registered per Service via SetEndpoints
+	registry *endpointRegistry
+
+	// transitionFn an optional function notified when the status of an endpoint changes
+	transitionFn TransitionFunc
+
+	// rejectionFn an optional function notified when a sample is rejected as invalid
+	rejectionFn RejectionFunc
+
+	// checkpointer periodically persists the store, it is nil unless configured via WithCheckpoint
+	checkpointer *checkpointer
+
+	// configReloader periodically reloads the configuration file, it is nil unless created via NewFailureDetectorFromConfigFile
+	configReloader *configReloader
+
+	// windowSize the max number of samples we are going to store and process per endpoint
+	windowSize int
+
+	// timeWindow and timeWindowBucket configure time-windowed endpoints, a zero timeWindow means endpoints keep the windowSize most recent samples
+	timeWindow       time.Duration
+	timeWindowBucket time.Duration
+
+	// endpointTTL is the time after which an endpoint that stopped receiving samples is removed from the store
+	endpointTTL time.Duration
+
+	// workers the number of workers that take batches of samples off the queue, they are serialized by the lock
+	workers int
+
+	// historySize the max number of transitions kept per endpoint, 0 disables the history
+	historySize int
+
+	// maxEjectionPercent caps the percentage of endpoints of a Service that can be ejected at the same time, 0 means no cap
+	maxEjectionPercent int
+
+	clock clock.Clock
+}
+
+const (
+	defaultEndpointTTL     = 60 * time.Second
+	defaultWindowSize      = 10
+	defaultWorkers         = 1
+	defaultChannelCapacity = 1000
+	defaultHistorySize     = 16
+)
+
+// Option configures optional features of the failure detector
+type Option func(fd *failureDetector)
+
+// WithOverflowPolicy sets the policy applied by Record when the collector channel is full,
+// an invalid policy (see OverflowPolicy.Validate) is reported and DefaultOverflowPolicy is used instead
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(fd *failureDetector) {
+		if err := policy.Validate(); err != nil {
+			utilruntime.HandleError(fmt.Errorf("ignoring the overflow policy: %v", err))
+			policy = DefaultOverflowPolicy
+		}
+		fd.processor.overflowPolicy = policy
+	}
+}
+
+// WithDefaultSamplingRate sets the sampling rate for Services that don't have a rate assigned via SetSamplingRate
+func WithDefaultSamplingRate(rate float64) Option {
+	return func(fd *failureDetector) {
+		fd.samplingRates.setDefault(rate)
+	}
+}
+
+// WithTransitionHandler sets a function that is notified when the status of an endpoint changes
+func WithTransitionHandler(fn TransitionFunc) Option {
+	return func(fd *failureDetector) {
+		fd.transitionFn = fn
+	}
+}
+
+// WithCheckpoint periodically persists the status of endpoints along with the recent samples, the last decision and the history to the given file.
+// The file is loaded when the detector starts, entries that haven't been updated within maxAge are ignored.
+// The state of policies (PolicyResult.State) isn't persisted, stateful policies start over from the restored samples and weight
+// (e.g. NewEWMAPolicy rebuilds its averages from the restored samples)
+func WithCheckpoint(path string, interval, maxAge time.Duration) Option {
+	return func(fd *failureDetector) {
+		fd.checkpointer = &checkpointer{path: path, interval: interval, maxAge: maxAge}
+	}
+}
+
+// WithEndpointKeyFunction sets the function that identifies endpoints within a Service, HostEndpointKey is used by default
+func WithEndpointKeyFunction(fn EndpointKeyFunc) Option {
+	return func(fd *failureDetector) {
+		fd.endpointKeyFn = fn
+	}
+}
+
+// WithWindowSize sets the number of recent samples kept and assessed per endpoint
+func WithWindowSize(size int) Option {
+	return func(fd *failureDetector) {
+		if size > 0 {
+			fd.windowSize = size
+		}
+	}
+}
+
+// WithEndpointTTL sets the time after which an endpoint that stopped receiving samples is forgotten
+func WithEndpointTTL(ttl time.Duration) Option {
+	return func(fd *failureDetector) {
+		if ttl > 0 {
+			fd.endpointTTL = ttl
+		}
+	}
+}
+
+// WithWorkers sets the number of workers that take batches of samples off the queue.
+// Note that processing is serialized: a worker holds the detector's lock for the whole batch because the limits, the ejection cap
+// and the published snapshot span all Services. Additional workers only pick up the next batch while one is being processed,
+// they don't make batches of different Services processed in parallel, thus more than one worker rarely pays off
+func WithWorkers(workers int) Option {
+	return func(fd *failureDetector) {
+		if workers > 0 {
+			fd.workers = workers
+		}
+	}
+}
+
+// WithChannelCapacity sets the capacity of the collector channels, the one exposed via Collector and the one used by Record
+func WithChannelCapacity(capacity int) Option {
+	return func(fd *failureDetector) {
+		if capacity > 0 {
+			fd.processor.collectCh = make(chan *EndpointSample, capacity)
+			fd.processor.uncheckedCh = make(chan *EndpointSample, capacity)
+		}
+	}
+}
+
+// WithMaxEjectionPercent caps the percentage of endpoints of a Service that can be ejected at the same time,
+// see SetMaxEjectionPercent
+func WithMaxEjectionPercent(percent int) Option {
+	return func(fd *failureDetector) {
+		fd.maxEjectionPercent = percent
+	}
+}
+
+// WithProbeDefaults sets the values used for fields that aren't set in ProbeConfig passed to SetProbeTargets
+func WithProbeDefaults(config ProbeConfig) Option {
+	return func(fd *failureDetector) {
+		fd.prober.setDefaults(config)
+	}
+}
+
+// WithClock sets the clock used by the detector, its stores and the prober, useful for tests and simulations
+func WithClock(clock clock.Clock) Option {
+	return func(fd *failureDetector) {
+		fd.clock = clock
+		fd.prober.clock = clock
+	}
+}
+
+// NewDefaultFailureDetector creates a detector configured by the given options,
+// policy rules that don't fit the detector once all options have been applied (see PolicyRule.RequiresSamples) are reported and removed
+func NewDefaultFailureDetector(opts ...Option) *failureDetector {
+	fd := newConfiguredFailureDetector(opts...)
+	if err := fd.removeInvalidPolicyRules(); err != nil {
+		utilruntime.HandleError(fmt.Errorf("removed policies that don't fit the detector: %v", err))
+	}
+	return fd
 }
 
-func NewDefaultFailureDetector() *failureDetector {
-	createNewStoreFn := func(ttl time.Duration) WeightedEndpointStatusStore {
-		return newEndpointStore(ttlstore.New(ttl, clock.RealClock{}))
+// newConfiguredFailureDetector creates a detector with the default settings and applies the given options
+func newConfiguredFailureDetector(opts ...Option) *failureDetector {
+	var fd *failureDetector
+	createNewStoreFn := func(ttl time.Duration) *WeightedEndpointStatusStore {
+		return NewStore[string, *WeightedEndpointStatus](ttl, fd.clock)
 	}
-	queue := newEndPointSampleBatchQueue(batchqueue.New())
-	return newFailureDetector(EndpointSampleToServiceKeyFunction, SimpleWeightedEndpointStatusEvaluator, createNewStoreFn, queue)
+	fd = newFailureDetector(EndpointSampleToServiceKeyFunction, SimpleWeightedEndpointStatusEvaluator, createNewStoreFn, NewBatchQueue[string, *EndpointSample]())
+	for _, opt := range opts {
+		opt(fd)
+	}
+	return fd
 }
 
-func newFailureDetector(endpointSampleKeyKeyFn KeyFunc, policyEvaluator EvaluateFunc, createStoreFn NewStoreFunc, queue endPointSampleBatchQueue) *failureDetector {
+func newFailureDetector(endpointSampleKeyKeyFn KeyFunc, policyEvaluator EvaluateFunc, createStoreFn NewStoreFunc, queue *endPointSampleBatchQueue) *failureDetector {
 	fd := &failureDetector{}
 	processor := newProcessor(endpointSampleKeyKeyFn, fd.processBatch, queue)
+	processor.admitFn = fd.admit
 	fd.processor = processor
-	fd.store = map[string]WeightedEndpointStatusStore{}
+	fd.store = NewStore[serviceName, *WeightedEndpointStatusStore](0, clock.RealClock{})
 	fd.endpointSampleKeyFn = endpointSampleKeyKeyFn
+	fd.endpointKeyFn = HostEndpointKey
 	fd.createStoreFn = createStoreFn
 	fd.policyEvaluatorFn = policyEvaluator
+	fd.samplingRates = newSamplingRates()
+	fd.policies = newPolicies()
+	fd.prober = newProber(fd.Record)
+	fd.registry = newEndpointRegistry()
+	fd.windowSize = defaultWindowSize
+	fd.endpointTTL = defaultEndpointTTL
+	fd.workers = defaultWorkers
+	fd.historySize = defaultHistorySize
+	fd.clock = clock.RealClock{}
 	return fd
 }
 
+// newEndpoint creates WeightedEndpointStatus for the given URL that keeps samples as configured by WithWindowSize or WithTimeWindow
+func (fd *failureDetector) newEndpoint(url *url.URL) *WeightedEndpointStatus {
+	if fd.timeWindow > 0 {
+		return newTimeWindowedEndpoint(fd.timeWindow, fd.timeWindowBucket, url)
+	}
+	return newWeightedEndpoint(fd.windowSize, url)
+}
+
 // processBatch starts processing the retrieved EndPointSamples
 // first samples are added to the internal store
 // then it calls out to external policy function for assessing
@@ -61,109 +284,199 @@ func (fd *failureDetector) processBatch(endpointSamples []*EndpointSample) {
 	if len(endpointSamples) == 0 {
 		return
 	}
-	batchKey := fd.endpointSampleKeyFn(endpointSamples[0])
-	endpointsStore := fd.store[batchKey]
-	if endpointsStore == nil {
-		endpointsStore = fd.createStoreFn(60 * time.Second)
+	atomic.AddUint64(&fd.processedSamples, uint64(len(endpointSamples)))
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	batchService := serviceName{namespace: endpointSamples[0].Namespace, service: endpointSamples[0].Service}
+	endpointsStore, ok := fd.store.Get(batchService)
+	if !ok {
+		endpointsStore = fd.createStoreFn(fd.endpointTTL)
 	}
+	trackedEndpoints := endpointsStore.Len()
+	// expired endpoints must not count against the limits
+	endpointsStore.RemoveExpired()
+	hasChanged := endpointsStore.Len() != trackedEndpoints
 
 	visitedEndpointsKey := sets.NewString()
 	for _, endpointSample := range endpointSamples {
-		endpointKey, sample := convertToKeySample(endpointSample)
-		endpoint := endpointsStore.Get(endpointKey)
-		if endpoint == nil {
-			// the max number of samples we are going to store and process per endpoint is 10 (it could be configurable)
-			endpoint = newWeightedEndpoint(10, endpointSample.URL)
+		endpointKey, sample := fd.convertToKeySample(endpointSample)
+		if len(endpointKey) == 0 {
+			// the sample can't be attributed to an endpoint
+			fd.reject(endpointSample, RejectionReasonMissingEndpointKey)
+			continue
+		}
+		if registered, hasService := fd.registry.isRegistered(endpointSample.Namespace, endpointSample.Service, endpointKey); hasService && !registered {
+			// the endpoint doesn't belong to the Service (anymore)
+			continue
+		}
+		endpoint, ok := endpointsStore.Get(endpointKey)
+		if !ok {
+			endpoint = fd.newEndpoint(endpointSample.URL)
+			endpoint.key = endpointKey
+			endpoint.namespace = endpointSample.Namespace
+			endpoint.service = endpointSample.Service
 		}
 		if !visitedEndpointsKey.Has(endpointKey) {
 			visitedEndpointsKey.Insert(endpointKey)
 		}
 		endpoint.Add(sample)
+		endpoint.lastUpdate = fd.clock.Now()
 		endpointsStore.Add(endpointKeyFunction(endpoint), endpoint)
 	}
 
-	hasChanged := false
+	policy := fd.policyFor(batchService.namespace, batchService.service)
 	for _, visitedEndpointKey := range visitedEndpointsKey.UnsortedList() {
-		endpoint := endpointsStore.Get(visitedEndpointKey)
-		if fd.policyEvaluatorFn(endpoint) {
+		endpoint, _ := endpointsStore.Get(visitedEndpointKey)
+		oldStatus, oldWeight := endpoint.status, endpoint.weight
+		result := policy(endpoint)
+		if len(oldStatus) == 0 && len(result.Status) > 0 && !fd.canEject(endpointsStore) {
+			// the cap has been reached, the endpoint keeps the weight computed by the policy but it isn't ejected
+			result.Status = oldStatus
+			result.Reason = PolicyReasonMaxEjectionPercent
+			if len(result.Explanation) > 0 {
+				result.Explanation = fmt.Sprintf("not ejected because the max ejection percent has been reached, %s", result.Explanation)
+			} else {
+				result.Explanation = "not ejected because the max ejection percent has been reached"
+			}
+		}
+		if endpoint.apply(result) {
 			hasChanged = true
 			endpointsStore.Add(endpointKeyFunction(endpoint), endpoint)
 		}
+		if endpoint.latency != nil && fd.clock.Since(endpoint.latency.publishedAt) >= latencyPublishInterval {
+			// refresh the percentiles seen by readers even if the status and the weight haven't changed
+			endpoint.latency.publishedAt = fd.clock.Now()
+			hasChanged = true
+		}
+		if oldStatus != endpoint.status {
+			endpoint.lastTransition = fd.clock.Now()
+		}
+		if oldStatus != endpoint.status || oldWeight != endpoint.weight {
+			endpoint.recordTransition(StatusTransition{
+				Time:      fd.clock.Now(),
+				OldStatus: oldStatus,
+				NewStatus: endpoint.status,
+				OldWeight: oldWeight,
+				NewWeight: endpoint.weight,
+				Reason:    endpoint.reason,
+				Message:   endpoint.message,
+			}, fd.historySize)
+		}
+		if oldStatus != endpoint.status && fd.transitionFn != nil {
+			fd.transitionFn(EndpointTransition{
+				Namespace: endpointSamples[0].Namespace,
+				Service:   endpointSamples[0].Service,
+				URL:       endpoint.url,
+				OldStatus: oldStatus,
+				NewStatus: endpoint.status,
+				Weight:    endpoint.weight,
+			})
+		}
 	}
 
-	fd.store[batchKey] = endpointsStore
+	fd.store.Add(batchService, endpointsStore)
+	fd.trackedEndpoints += endpointsStore.Len() - trackedEndpoints
+	changedServices := fd.enforceLimits(batchService)
 	if hasChanged {
-		fd.propagateChangesToReadOnlyStore()
+		changedServices = append(changedServices, batchService)
 	}
+	fd.propagateChangesToReadOnlyStore(changedServices...)
 }
 
 func (fd *failureDetector) Run(ctx context.Context) {
-	// if you ever change the number of workers then you need to provide a thread-safe store
-	fd.processor.run(ctx, 1)
+	if fd.checkpointer != nil {
+		fd.restoreCheckpoint()
+		go fd.checkpointer.run(ctx, fd.writeCheckpoint)
+	}
+	go fd.prober.run(ctx)
+	go wait.Until(fd.removeExpired, fd.endpointTTL, ctx.Done())
+	if fd.configReloader != nil {
+		go fd.configReloader.run(ctx, fd.reloadConfig)
+	}
+
+	// workers are serialized by the lock (see WithWorkers), the queue never hands out batches of a single Service to more than one worker
+	fd.processor.run(ctx, fd.workers)
 }
 
-// Collector exposes a chan for collecting EndpointSamples
-func (fd *failureDetector) Collector() chan<- *EndpointSample {
-	return fd.processor.collectCh
+// ProcessPending synchronously processes all samples waiting in the collector channel.
+// It is meant for tests and simulations that drive the detector without calling Run, it must not be called while the detector is running
+func (fd *failureDetector) ProcessPending() {
+	fd.processor.processPending()
 }
 
-// EndpointStatus returns the current status of the given endpoint for the given Service
-func (fd *failureDetector) EndpointStatus(namespace, service string, url *url.URL) (isHealthy bool, weight float32) {
-	isHealthy = true
-	weight = 1.0
+// Collector exposes a chan for collecting EndpointSamples, invalid samples are rejected by the collector (see RejectedSamples)
+// note that sending blocks when the detector falls behind, use Record on latency sensitive paths
+func (fd *failureDetector) Collector() chan<- *EndpointSample {
+	return fd.processor.uncheckedCh
+}
 
-	store := fd.readOnlyStore.Load()
-	if store == nil {
-		// nothing has been exported yet
-		// consider the endpoint healthy
-		return
+// Record hands the given EndpointSample over to the detector without ever blocking the caller
+// when the detector falls behind the configured OverflowPolicy decides which samples are discarded
+// successful samples are additionally thinned according to the sampling rate of the Service
+// it returns false only if the sample has been discarded because of an overflow or rejected as invalid (see RejectedSamples)
+func (fd *failureDetector) Record(endpointSample *EndpointSample) bool {
+	if !fd.admit(endpointSample) {
+		return false
 	}
-
-	serviceStore := store.(map[string]WeightedEndpointStatusStore)
-	epSample := &EndpointSample{Namespace: namespace, Service:service, URL:url}
-
-	serviceKey := fd.endpointSampleKeyFn(epSample)
-	endpointsStore := serviceStore[serviceKey]
-	if endpointsStore == nil {
-		// we haven't collected any data for this Service
-		// consider the endpoint healthy
-		return
+	keep, samplingRate := fd.samplingRates.keep(endpointSample)
+	if !keep {
+		return true
 	}
-
-	endpointKey, _ := convertToKeySample(epSample)
-	endpoint := endpointsStore.Get(endpointKey)
-	if endpoint == nil {
-		// we haven't collected any data for this endpoint
-		// consider the endpoint healthy
-		return
+	if samplingRate > 0 {
+		// the caller's sample might be reused or shared, the rate is carried by a copy
+		thinnedSample := *endpointSample
+		thinnedSample.samplingRate = samplingRate
+		endpointSample = &thinnedSample
 	}
+	return fd.processor.record(endpointSample)
+}
 
-	weight = endpoint.weight
-	isHealthy = len(endpoint.status) == 0
+// SetSamplingRate sets the fraction of successful samples passed to Record that will be processed for the given Service.
+// Samples that carry an error are always processed, the kept successful samples are accounted as 1/rate requests
+// so that the policies see the same error to success ratio. Rates are clamped to the (0, 1] range and NaN disables thinning.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetSamplingRate(namespace, service string, rate float64) {
+	fd.samplingRates.set(namespace, service, rate)
+}
 
-    return
+// DroppedSamples returns the number of samples discarded by Record because the detector couldn't keep up
+func (fd *failureDetector) DroppedSamples() uint64 {
+	return fd.processor.dropped()
 }
 
-func convertToKeySample(epSample *EndpointSample) (string, *Sample) {
-	return EndpointSampleKeyFunction(epSample), &Sample{
-		err: epSample.Err,
-	}
+// ProcessedSamples returns the number of samples processed so far
+func (fd *failureDetector) ProcessedSamples() uint64 {
+	return atomic.LoadUint64(&fd.processedSamples)
 }
 
-// propagateChangesToReadOnlyStore makes a copy of fd.store and puts it into fd.readOnlyStore
-func (fd *failureDetector) propagateChangesToReadOnlyStore() {
-	serviceStoreCopy := map[string]WeightedEndpointStatusStore{}
-	for serviceKey, epStore := range fd.store {
-		newEpStore := fd.createStoreFn(24 * 365 * time.Hour)
-		for _, weightedEndpointStatus := range epStore.List() {
-			weightedEndpointStatusCopy := newWeightedEndpoint(0, weightedEndpointStatus.url)
-			weightedEndpointStatusCopy.weight = weightedEndpointStatus.weight
-			weightedEndpointStatusCopy.status = weightedEndpointStatus.status
-			newEpStore.Add(endpointKeyFunction(weightedEndpointStatusCopy), weightedEndpointStatusCopy)
+// SetProbeTargets actively probes the given endpoints of the given Service according to the config,
+// the results go through the same pipeline as the samples passed to Record and are marked as active.
+// It replaces the endpoints registered previously for the Service, an empty list stops probing the Service.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetProbeTargets(namespace, service string, config ProbeConfig, endpoints []*url.URL) {
+	fd.prober.set(namespace, service, config, endpoints)
+}
 
-		}
-		serviceStoreCopy[serviceKey] = newEpStore
-	}
+// EndpointStatus returns the current status of the given endpoint for the given Service
+// endpoints registered as not ready or terminating (see SetEndpointsWithConditions) are reported as unhealthy
+// callers that check endpoints of the same Service repeatedly should keep the view returned by Lookup instead
+func (fd *failureDetector) EndpointStatus(namespace, service string, url *url.URL) (isHealthy bool, weight float32) {
+	return fd.Lookup(namespace, service).EndpointStatus(url)
+}
 
-	fd.readOnlyStore.Store(serviceStoreCopy)
+func (fd *failureDetector) convertToKeySample(epSample *EndpointSample) (string, *Sample) {
+	sample := &Sample{
+		err:     epSample.Err,
+		active:  epSample.Active,
+		latency: epSample.Latency,
+	}
+	sample.timestamp = epSample.Timestamp
+	if sample.timestamp.IsZero() {
+		sample.timestamp = fd.clock.Now()
+	}
+	if epSample.samplingRate > 0 {
+		sample.count = 1 / epSample.samplingRate
+	}
+	return fd.endpointKeyFn(epSample.URL, epSample.EndpointID), sample
 }
@@ -0,0 +1,152 @@
+package failure_detector
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestTransitionHandler(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	scenarios := []struct {
+		name                string
+		samples             []*EndpointSample
+		expectedTransitions []EndpointTransition
+	}{
+		{
+			name:    "weight changes are not transitions",
+			samples: genSamples(endpoint, 50, true),
+		},
+		{
+			name:    "ejection",
+			samples: genSamples(endpoint, 100, true),
+			expectedTransitions: []EndpointTransition{
+				{Namespace: "ns", Service: "etcd", URL: endpoint, NewStatus: EndpointStatusReasonTooManyErrors},
+			},
+		},
+		{
+			name:    "ejection and recovery",
+			samples: append(genSamples(endpoint, 100, true), genSamples(endpoint, 10, false)...),
+			expectedTransitions: []EndpointTransition{
+				{Namespace: "ns", Service: "etcd", URL: endpoint, NewStatus: EndpointStatusReasonTooManyErrors},
+				{Namespace: "ns", Service: "etcd", URL: endpoint, OldStatus: EndpointStatusReasonTooManyErrors, Weight: 0.1},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			actualTransitions := []EndpointTransition{}
+			target := NewDefaultFailureDetector(WithTransitionHandler(func(transition EndpointTransition) {
+				actualTransitions = append(actualTransitions, transition)
+			}))
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			if len(actualTransitions) != len(scenario.expectedTransitions) {
+				t.Fatalf("expected %d transitions but got %+v", len(scenario.expectedTransitions), actualTransitions)
+			}
+			for i, actual := range actualTransitions {
+				expected := scenario.expectedTransitions[i]
+				// the weight is a float, compare the number of errors it represents
+				if weightToErrorCount(actual.Weight) != weightToErrorCount(expected.Weight) {
+					t.Fatalf("expected %v weight but got %v", expected.Weight, actual.Weight)
+				}
+				actual.Weight, expected.Weight = 0, 0
+				if !reflect.DeepEqual(actual, expected) {
+					t.Fatalf("expected %+v transition but got %+v", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointKeyFunction(t *testing.T) {
+	httpEndpoint := &url.URL{Scheme: "http", Host: "1.1.1.1"}
+	httpsEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.1"}
+	scenarios := []struct {
+		name                    string
+		options                 []Option
+		samples                 []*EndpointSample
+		expectedHTTPHealthy     bool
+		expectedHTTPSHealthy    bool
+		expectedRejectedSamples uint64
+	}{
+		{
+			name:    "endpoints are identified by the host by default",
+			samples: append(genSamples(httpEndpoint, 100, true), &EndpointSample{Namespace: "ns", Service: "etcd"}),
+			// a sample without a URL is rejected
+			expectedRejectedSamples: 1,
+		},
+		{
+			name:                 "endpoints identified by the scheme and the host are tracked separately",
+			options:              []Option{WithEndpointKeyFunction(SchemeHostEndpointKey)},
+			samples:              genSamples(httpEndpoint, 100, true),
+			expectedHTTPSHealthy: true,
+		},
+		{
+			name:    "samples without an endpoint ID are rejected",
+			options: []Option{WithEndpointKeyFunction(EndpointIDKey)},
+			samples: append(genSamples(httpEndpoint, 100, true),
+				&EndpointSample{Namespace: "ns", Service: "etcd", URL: httpEndpoint, EndpointID: "pod-a"}),
+			expectedHTTPHealthy:     true,
+			expectedHTTPSHealthy:    true,
+			expectedRejectedSamples: 100,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewDefaultFailureDetector(scenario.options...)
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			if isHealthy, _ := target.EndpointStatus("ns", "etcd", httpEndpoint); isHealthy != scenario.expectedHTTPHealthy {
+				t.Fatalf("expected the http endpoint to be healthy=%v", scenario.expectedHTTPHealthy)
+			}
+			if isHealthy, _ := target.EndpointStatus("ns", "etcd", httpsEndpoint); isHealthy != scenario.expectedHTTPSHealthy {
+				t.Fatalf("expected the https endpoint to be healthy=%v", scenario.expectedHTTPSHealthy)
+			}
+			if target.RejectedSamples() != scenario.expectedRejectedSamples {
+				t.Fatalf("expected %d rejected samples but got %d", scenario.expectedRejectedSamples, target.RejectedSamples())
+			}
+		})
+	}
+}
+
+func TestEndpointStatusWithID(t *testing.T) {
+	target := NewDefaultFailureDetector(WithEndpointKeyFunction(EndpointIDKey))
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1"}
+	for _, endpointSample := range genSamples(endpoint, 100, true) {
+		endpointSample.EndpointID = "pod-a"
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+
+	view := target.Lookup("ns", "etcd")
+	if isHealthy, _ := view.EndpointStatusWithID(endpoint, "pod-a"); isHealthy {
+		t.Fatal("expected pod-a to be unhealthy")
+	}
+	if isHealthy, _ := view.EndpointStatusWithID(endpoint, "pod-b"); !isHealthy {
+		t.Fatal("expected pod-b to be healthy")
+	}
+
+	// endpoints that share the URL are registered and reported separately
+	target.SetEndpointsWithIDs("ns", "etcd", map[string]*url.URL{"pod-a": endpoint, "pod-b": endpoint})
+	if health, _ := view.EndpointHealthWithID(endpoint, "pod-a"); health != EndpointUnhealthy {
+		t.Fatalf("expected pod-a to be unhealthy, got %v", health)
+	}
+	if health, _ := view.EndpointHealthWithID(endpoint, "pod-b"); health != EndpointUnknown {
+		t.Fatalf("expected no data for pod-b, got %v", health)
+	}
+	if health, _ := view.EndpointHealthWithID(endpoint, "pod-c"); health != EndpointUnknown {
+		t.Fatalf("expected pod-c not to be registered, got %v", health)
+	}
+	if details := view.EndpointStatusDetailsWithID(endpoint, "pod-a"); details.Health != EndpointUnhealthy || details.Status != EndpointStatusReasonTooManyErrors {
+		t.Fatalf("expected the details of pod-a to report the ejection, got %+v", details)
+	}
+	if details := view.EndpointStatusDetailsWithID(endpoint, "pod-c"); details.Health != EndpointUnknown || details.Message != "the endpoint isn't registered for the Service" {
+		t.Fatalf("expected the details of pod-c to report an unregistered endpoint, got %+v", details)
+	}
+}
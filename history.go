@@ -0,0 +1,41 @@
+package failure_detector
+
+import "time"
+
+// StatusTransition describes a change of the status or the weight of an endpoint
+type StatusTransition struct {
+	Time      time.Time `json:"time"`
+	OldStatus string    `json:"oldStatus"`
+	NewStatus string    `json:"newStatus"`
+	OldWeight float32   `json:"oldWeight"`
+	NewWeight float32   `json:"newWeight"`
+
+	// Reason and Message describe the decision that caused the transition, see EndpointStatusDetails
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WithHistorySize sets the max number of transitions kept per endpoint (16 by default), 0 disables the history.
+// The history is exposed via Snapshot and DebugHandler
+func WithHistorySize(size int) Option {
+	return func(fd *failureDetector) {
+		fd.historySize = size
+	}
+}
+
+// recordTransition appends the given transition to the history of the endpoint dropping the oldest ones above the given size,
+// it allocates a new slice as the current one might be shared with a snapshot
+func (ep *WeightedEndpointStatus) recordTransition(transition StatusTransition, size int) {
+	if size <= 0 {
+		ep.history = nil
+		return
+	}
+
+	kept := ep.history
+	if len(kept) >= size {
+		kept = kept[len(kept)-size+1:]
+	}
+	history := make([]StatusTransition, 0, len(kept)+1)
+	history = append(history, kept...)
+	ep.history = append(history, transition)
+}
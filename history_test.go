@@ -0,0 +1,83 @@
+package failure_detector
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestStatusHistory(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name            string
+		historySize     int
+		expectedHistory []StatusTransition
+	}{
+		{
+			name:        "ejected and restored",
+			historySize: 3,
+			expectedHistory: []StatusTransition{
+				{Time: now, OldStatus: "", NewStatus: EndpointStatusReasonTooManyErrors, OldWeight: weightAfterErrors(90), NewWeight: 0, Reason: EndpointStatusReasonTooManyErrors, Message: "10 of last 10 requests failed: error 99"},
+				{Time: now.Add(time.Minute), OldStatus: EndpointStatusReasonTooManyErrors, NewStatus: "", OldWeight: 0, NewWeight: weightAfterErrors(90), Reason: SimplePolicyReasonErrorCountChanged, Message: "0 of last 10 requests failed"},
+				{Time: now.Add(2 * time.Minute), OldStatus: "", NewStatus: "", OldWeight: weightAfterErrors(90), NewWeight: weightAfterErrors(80), Reason: SimplePolicyReasonErrorCountChanged, Message: "0 of last 10 requests failed"},
+			},
+		},
+		{
+			name: "disabled",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock(now)
+			target := NewDefaultFailureDetector(WithHistorySize(scenario.historySize))
+			target.clock = fakeClock
+
+			for _, endpointSample := range genSamples(endpoint, 100, true) {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+			for _, endpointSample := range genSamples(endpoint, 20, false) {
+				fakeClock.Step(time.Minute / 10)
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			actualHistory := target.Snapshot().Services[0].Endpoints[0].History
+			if !reflect.DeepEqual(actualHistory, scenario.expectedHistory) {
+				t.Fatalf("expected %+v history but got %+v", scenario.expectedHistory, actualHistory)
+			}
+		})
+	}
+}
+
+func TestRecordTransition(t *testing.T) {
+	endpoint := newWeightedEndpoint(defaultWindowSize, nil)
+	for i := 0; i < 5; i++ {
+		endpoint.recordTransition(StatusTransition{Message: string(rune('a' + i))}, 3)
+	}
+	shared := endpoint.history
+
+	endpoint.recordTransition(StatusTransition{Message: "f"}, 3)
+	messages := func(history []StatusTransition) string {
+		ret := ""
+		for _, transition := range history {
+			ret += transition.Message
+		}
+		return ret
+	}
+	if actual := messages(endpoint.history); actual != "def" {
+		t.Fatalf("expected the three most recent transitions but got %q", actual)
+	}
+	if actual := messages(shared); actual != "cde" {
+		t.Fatalf("the previous history must not be modified, got %q", actual)
+	}
+}
+
+// weightAfterErrors returns the weight assigned by SimpleWeightedEndpointStatusEvaluator after the given number of errors
+func weightAfterErrors(errors int) float32 {
+	return 1 - 1/float32(DefaultSimplePolicyConfig.MaxErrors)*float32(errors)
+}
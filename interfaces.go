@@ -2,174 +2,229 @@ package failure_detector
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"strings"
 	"time"
 )
 
 type KeyFunc func(obj interface{}) string
 
+// EndpointKeyFunc a function used for deriving a key that uniquely identifies an endpoint of a Service from its URL and the optional endpoint ID,
+// an empty key means the endpoint can't be identified
+type EndpointKeyFunc func(url *url.URL, endpointID string) string
+
 // NewStoreFunc a func for creating WeightedEndpointStatus store per Service
-type NewStoreFunc func(ttl time.Duration) WeightedEndpointStatusStore
+type NewStoreFunc func(ttl time.Duration) *WeightedEndpointStatusStore
+
+// EvaluateFunc a function to an external policy evaluator that assesses the given endpoint based on the collected samples.
+// It must not modify the endpoint, the returned decision is applied by the detector
+type EvaluateFunc func(endpoint *WeightedEndpointStatus) PolicyResult
+
+// PolicyResult describes the decision of a policy
+type PolicyResult struct {
+	// Status an empty status means the endpoint is healthy otherwise it holds the reason the endpoint is considered unhealthy (e.g. EndpointStatusReasonTooManyErrors)
+	Status string
+
+	// Weight is a number in the [0, 1] range
+	Weight float32
 
-// EvaluateFunc a function to an external policy evaluator that sets the status and weight of the given endpoint based on the collected samples.
-type EvaluateFunc func(endpoint *WeightedEndpointStatus) bool
+	// Reason a short, CamelCase identifier of the decision, it might be empty when the decision keeps the current status and weight
+	Reason string
 
-// Store an in-memory store for storing and retrieving arbitrary data
-//
-// For now it is used by newEndpointStore function and converted to a strongly typed store (WeightedEndpointStatus)
-// It will be removed in the future once we move the store implementation to this package
-type Store interface {
-	// Add adds the given object to the store under the given key
-	Add(key string, obj interface{})
+	// Explanation a human-readable description of the decision
+	Explanation string
 
-	// Get retrieves an object from the store at the given key
-	Get(key string) interface{}
+	// ResetSamples discards the samples collected for the endpoint once the decision has been applied,
+	// policies use it so that the same samples aren't accounted more than once
+	ResetSamples bool
 
-	// List returns all objects in the store
-	List() []interface{}
+	// State is kept with the endpoint and handed back to the policy via WeightedEndpointStatus.PolicyState on the next evaluation,
+	// policies use it for data that outlives the window of samples (e.g. counters). A nil State clears it
+	State interface{}
 }
 
+// TransitionFunc a function notified when the status of an endpoint changes, for example when it gets ejected (EndpointStatusReasonTooManyErrors) or recovers.
+// It is called synchronously by the worker and must not block
+type TransitionFunc func(transition EndpointTransition)
+
 // WeightedEndpointStatusStore an in-memory store for WeightedEndpointStatus.
 // It automatically removed entries that exceed the configured TTL
 // as that allows for removing unused/removed endpoints
-type WeightedEndpointStatusStore interface {
-	// Add adds the given object to the store under the given key
-	Add(key string, obj *WeightedEndpointStatus)
+type WeightedEndpointStatusStore = Store[string, *WeightedEndpointStatus]
 
-	// Get retrieves WeightedEndpointStatus from the store at the given key
-	Get(key string) *WeightedEndpointStatus
+// endPointSampleBatchQueue a queue that groups EndpointSamples by the Service they were collected for
+type endPointSampleBatchQueue = BatchQueue[string, *EndpointSample]
 
-	// List returns all WeightedEndpointStatus in the store
-	List() []*WeightedEndpointStatus
-}
+// EndpointSample represents a sample collected for an endpoint derived from a proxied request.
+// it holds:
+//  - Namespace, Service and URL to uniquely identify the request
+//  - an optional EndpointID that identifies the endpoint when the URL isn't enough (see EndpointIDKey)
+//  - an optional Err returned from the proxy
+//  - Active set for samples produced by the prober rather than derived from real traffic
+//  - an optional Latency of the request
+//  - an optional Timestamp of the request, the time the sample is processed is used when not set
+type EndpointSample struct {
+	Namespace string
+	Service   string
+	URL       *url.URL
+	Err       error
+	Active    bool
+	Latency   time.Duration
+	Timestamp time.Time
 
-// endpointStore implements WeightedEndpointStatusStore interface
-type endpointStore struct {
-	Store
-}
+	EndpointID string
 
-// newEndpointStore creates a new strongly typed store that implements WeightedEndpointStatusStore interface
-func newEndpointStore(delegate Store) *endpointStore {
-	return &endpointStore{Store: delegate}
+	// samplingRate is set when the sample survived thinning, zero means the sample hasn't been thinned
+	samplingRate float64
 }
 
-// Add adds the given WeightedEndpointStatus to the store under the given key
-func (e *endpointStore) Add(key string, ep *WeightedEndpointStatus) {
-	e.Store.Add(key, ep)
+// EndpointTransition describes a change of the status of an endpoint,
+// an empty status means the endpoint is healthy otherwise it holds the reason the endpoint is considered unhealthy
+type EndpointTransition struct {
+	Namespace string
+	Service   string
+	URL       *url.URL
+	OldStatus string
+	NewStatus string
+	Weight    float32
 }
 
-// Get retrieves a WeightedEndpointStatus from the store under the given key
-func (e *endpointStore) Get(key string) *WeightedEndpointStatus {
-	rawEndpoint := e.Store.Get(key)
-	if rawEndpoint == nil {
-		return nil
-	}
-	return rawEndpoint.(*WeightedEndpointStatus)
-}
+// WeightedEndpointStatus represents the current status of the given endpoint based on the collected samples.
+// The status will be examined and filled by the external policy.
+type WeightedEndpointStatus struct {
+	data     []*Sample
+	position int
+	size     int
 
-// List returns all WeightedEndpointStatus in the store
-func (e *endpointStore) List() []*WeightedEndpointStatus {
-	rawEndpoints := e.Store.List()
-	endpoints := make([]*WeightedEndpointStatus, len(rawEndpoints))
-	for idx, rawEndpoint := range rawEndpoints {
-		endpoints[idx] = rawEndpoint.(*WeightedEndpointStatus)
-	}
-	return endpoints
-}
+	// window replaces data when the detector has been configured with WithTimeWindow
+	window *timeWindow
+
+	// addedSamples counts samples added so far, it is never reset
+	addedSamples uint64
+
+	// latency summarizes the latencies of the recent requests, it is nil until a latency is recorded
+	latency *latencySketch
+
+	// latencyPercentiles holds the percentiles computed from latency when the endpoint was copied to a snapshot
+	latencyPercentiles LatencyPercentiles
+
+	namespace string
+	service   string
+	url       *url.URL
+	key       string
+	status    string
+	weight    float32
 
-// BatchQueue represents a generic work queue that process items in the order in which they were added,
-// it also supports batching - items are grouped by a key and could be retrieved as a package
-//
-// For now it is used by newEndPointSampleBatchQueue function and converted to a strongly typed queue (endPointSampleBatchQueue)
-// It will be removed in the future once we move the queue implementation to this package
-type BatchQueue interface {
-	// Get retrieves the next batch of collected items/work along with the unique key
-	// A caller must execute the corresponding Done() method once it has finished its work
-	Get() (key string, items []interface{})
+	// policyState holds PolicyResult.State returned by the last evaluation
+	policyState interface{}
 
-	// Add adds the given item under the given key to the queue
-	Add(key string, item interface{})
+	// lastUpdate is the time the endpoint received the last sample
+	lastUpdate time.Time
 
-	// Done indicates that the caller finished working on items represented by a unique key
-	// if it has been added again while it was being processed, it will be re-added to the queue for re-processing
-	Done(key string)
+	// lastTransition is the time the status last changed
+	lastTransition time.Time
+
+	// reason, message, decisionSamples and decisionErrors describe the last decision of the policy, see EndpointStatusDetails
+	reason          string
+	message         string
+	decisionSamples int
+	decisionErrors  int
+
+	// history holds the most recent transitions, oldest first. The slice is never modified in place so that it can be shared with snapshots
+	history []StatusTransition
 }
 
-// BatchQueue represents work queue that process EndpointSamples in the order in which they were added,
-// it also supports batching - items are grouped by a key and could be retrieved as a package
-type endPointSampleBatchQueue interface {
-	// Get retrieves the next batch of collected EndpointSamples along with the unique key
-	// A caller must execute the corresponding Done() method once it has finished its work
-	Get() (key string, items []*EndpointSample)
+// Sample represents a single sample collected for an endpoint
+type Sample struct {
+	err     error
+	active  bool
+	latency time.Duration
 
-	// Add adds the given EndpointSample under the given key to the queue
-	Add(key string, item *EndpointSample)
+	// timestamp is the time the request was observed
+	timestamp time.Time
 
-	// Done indicates that the caller finished working on the batch of EndpointSamples represented by a unique key
-	// if it has been added again while it was being processed, it will be re-added to the queue for re-processing
-	Done(key string)
+	// count is the number of requests this sample stands for, it is greater than 1 for samples that survived thinning
+	// zero is treated as 1
+	count float64
 }
 
-// endpointSampleBatchQueue implements endPointSampleBatchQueue
-type endpointSampleBatchQueue struct {
-	BatchQueue
+// Err returns the error observed for the request, nil means success
+func (s *Sample) Err() error {
+	return s.err
 }
 
-// Get retrieves the next batch of collected EndpointSamples along with the unique key
-// A caller must execute the corresponding Done() method once it has finished its work
-func (q *endpointSampleBatchQueue) Get() (key string, items []*EndpointSample) {
-	key, rawEndpointSample := q.BatchQueue.Get()
-	endpointSamples := make([]*EndpointSample, len(rawEndpointSample))
-	for i, r := range rawEndpointSample {
-		endpointSamples[i] = r.(*EndpointSample)
-	}
-	return key, endpointSamples
+// IsActive returns true if the sample was produced by the prober rather than derived from real traffic
+func (s *Sample) IsActive() bool {
+	return s.active
 }
 
-// Add adds the given EndpointSample under the given key to the queue
-func (q *endpointSampleBatchQueue) Add(key string, item *EndpointSample) {
-	q.BatchQueue.Add(key, item)
+// Latency returns the latency of the request, zero means it hasn't been recorded
+func (s *Sample) Latency() time.Duration {
+	return s.latency
 }
 
-// Done indicates that the caller finished working on the batch of EndpointSamples represented by a unique key
-// if it has been added again while it was being processed, it will be re-added to the queue for re-processing
-func (q *endpointSampleBatchQueue) Done(key string) {
-	q.BatchQueue.Done(key)
+// Time returns the time the request was observed
+func (s *Sample) Time() time.Time {
+	return s.timestamp
 }
 
-// newEndPointSampleBatchQueue creates a strongly typed batch queue from the delegate
-// the returned queue implements endPointSampleBatchQueue interface
-func newEndPointSampleBatchQueue(delegate BatchQueue) endPointSampleBatchQueue {
-	return &endpointSampleBatchQueue{BatchQueue: delegate}
+// requestCount returns the number of requests this sample stands for
+func (s *Sample) requestCount() float64 {
+	if s.count <= 0 {
+		return 1
+	}
+	return s.count
 }
 
-// EndpointSample represents a sample collected for an endpoint derived from a proxied request.
-// it holds:
-//  - Namespace, Service and URL to uniquely identify the request
-//  - an optional Err returned from the proxy
-type EndpointSample struct {
-	Namespace string
-	Service   string
-	URL       *url.URL
-	Err       error
+// WindowCounts returns the counters of the samples collected within the time window,
+// it returns false when the detector hasn't been configured with WithTimeWindow
+func (ep *WeightedEndpointStatus) WindowCounts() (WindowCounts, bool) {
+	if ep.window == nil {
+		return WindowCounts{}, false
+	}
+	return ep.window.counts(), true
 }
 
-// WeightedEndpointStatus represents the current status of the given endpoint based on the collected samples.
-// The status will be examined and filled by the external policy.
-type WeightedEndpointStatus struct {
-	data     []*Sample
-	position int
-	size     int
+// sampleCounts returns the number of collected samples, the number of requests they stand for and how many of them failed
+// regardless of whether the samples are kept in a time window or not
+func (ep *WeightedEndpointStatus) sampleCounts() (samples int, requests, errors float64) {
+	if ep.window != nil {
+		counts := ep.window.counts()
+		return counts.Samples, counts.Requests, counts.Errors
+	}
+	for _, sample := range ep.data {
+		if sample == nil {
+			continue
+		}
+		samples++
+		requests += sample.requestCount()
+		if sample.err != nil {
+			errors += sample.requestCount()
+		}
+	}
+	return samples, requests, errors
+}
 
-	url    *url.URL
-	status string
-	weight float32
+// countSamples returns the number of requests the collected samples stand for, how many of them failed and the most recent error
+func (ep *WeightedEndpointStatus) countSamples() (requests, errors int, lastErr error) {
+	_, requestCount, errorCount := ep.sampleCounts()
+	if ep.window != nil {
+		lastErr = ep.window.lastErr
+	}
+	for _, sample := range ep.Get() {
+		if sample.err != nil {
+			lastErr = sample.err
+		}
+	}
+	return int(math.Round(requestCount)), int(math.Round(errorCount)), lastErr
 }
 
-// Sample represents a single sample collected for an endpoint
-type Sample struct {
-	err error
-	// TODO: store latency
+// newTimeWindowedEndpoint creates WeightedEndpointStatus for the given URL that counts samples in a time window, see WithTimeWindow
+func newTimeWindowedEndpoint(window, bucket time.Duration, url *url.URL) *WeightedEndpointStatus {
+	ep := newWeightedEndpoint(0, url)
+	ep.window = newTimeWindow(window, bucket)
+	return ep
 }
 
 // newWeightedEndpoint creates WeightedEndpointStatus for the given URL
@@ -178,14 +233,90 @@ func newWeightedEndpoint(size int, url *url.URL) *WeightedEndpointStatus {
 	ep := &WeightedEndpointStatus{}
 	ep.data = make([]*Sample, size, size)
 	ep.url = url
+	ep.key = HostEndpointKey(url, "")
 	ep.weight = 1
 	ep.size = size
 	return ep
 }
 
+// Namespace returns the namespace of the Service the endpoint belongs to
+func (ep *WeightedEndpointStatus) Namespace() string {
+	return ep.namespace
+}
+
+// Service returns the name of the Service the endpoint belongs to
+func (ep *WeightedEndpointStatus) Service() string {
+	return ep.service
+}
+
+// URL returns the URL of the endpoint
+func (ep *WeightedEndpointStatus) URL() *url.URL {
+	return ep.url
+}
+
+// Status returns the current status of the endpoint, an empty status means the endpoint is healthy
+func (ep *WeightedEndpointStatus) Status() string {
+	return ep.status
+}
+
+// Weight returns the current weight of the endpoint
+func (ep *WeightedEndpointStatus) Weight() float32 {
+	return ep.weight
+}
+
+// current returns a PolicyResult that keeps the current status and weight of the endpoint
+func (ep *WeightedEndpointStatus) current() PolicyResult {
+	return PolicyResult{Status: ep.status, Weight: ep.weight, State: ep.policyState}
+}
+
+// PolicyState returns PolicyResult.State returned by the last evaluation of the endpoint
+func (ep *WeightedEndpointStatus) PolicyState() interface{} {
+	return ep.policyState
+}
+
+// AddedSamples returns the number of samples added to the endpoint so far, unlike the window it is never reset.
+// Stateful policies use it to tell the samples they haven't seen yet
+func (ep *WeightedEndpointStatus) AddedSamples() uint64 {
+	return ep.addedSamples
+}
+
+// apply sets the status and the weight decided by a policy, it returns true only if either of them or the description of the decision has changed.
+// Decisions that keep the current status and weight without giving a reason don't replace the description of the previous decision
+func (ep *WeightedEndpointStatus) apply(result PolicyResult) bool {
+	hasChanged := ep.status != result.Status || ep.weight != result.Weight
+	if hasChanged || len(result.Reason) > 0 {
+		hasChanged = hasChanged || ep.reason != result.Reason || ep.message != result.Explanation
+		ep.reason = result.Reason
+		ep.message = result.Explanation
+		ep.decisionSamples, ep.decisionErrors, _ = ep.countSamples()
+	}
+	ep.status = result.Status
+	ep.weight = result.Weight
+	ep.policyState = result.State
+	if result.ResetSamples {
+		ep.data = make([]*Sample, ep.size, ep.size)
+		ep.position = 0
+		if ep.window != nil {
+			ep.window.reset()
+		}
+	}
+	return hasChanged
+}
+
 // Add adds the given sample to the internal store
 // it will overwrite the old values when it exceeds the configured capacity
 func (ep *WeightedEndpointStatus) Add(sample *Sample) {
+	ep.addedSamples++
+	if sample.latency > 0 {
+		if ep.latency == nil {
+			ep.latency = &latencySketch{}
+		}
+		ep.latency.add(sample.latency, sample.timestamp, sample.requestCount())
+	}
+	if ep.window != nil {
+		ep.window.add(sample)
+		return
+	}
 	size := cap(ep.data)
 	ep.position = ep.position % size
 	ep.data[ep.position] = sample
@@ -196,6 +327,9 @@ func (ep *WeightedEndpointStatus) Add(sample *Sample) {
 func (ep *WeightedEndpointStatus) Get() []*Sample {
 	size := cap(ep.data)
 	ret := []*Sample{}
+	if size == 0 {
+		return ret
+	}
 
 	for i := ep.position % size; i < size; i++ {
 		if ep.data[i] == nil {
@@ -217,22 +351,59 @@ func EndpointSampleToServiceKeyFunction(obj interface{}) string {
 	return fmt.Sprintf("%s/%s", item.Namespace, item.Service)
 }
 
-// EndpointSampleKeyFunction a function used for deriving a key from an EndpointSample that uniquely identifies it
+// EndpointSampleKeyFunction a function used for deriving a key from an EndpointSample that uniquely identifies it, see HostEndpointKey
 func EndpointSampleKeyFunction(obj interface{}) string {
 	item := obj.(*EndpointSample)
-	if item.URL == nil {
+	return HostEndpointKey(item.URL, item.EndpointID)
+}
+
+// endpointKeyFunction returns the key a WeightedEndpointStatus has been stored under
+func endpointKeyFunction(obj interface{}) string {
+	return obj.(*WeightedEndpointStatus).key
+}
+
+// HostEndpointKey identifies endpoints by the host and the port, it is the default EndpointKeyFunc
+func HostEndpointKey(url *url.URL, _ string) string {
+	if url == nil {
 		return ""
 	}
-	return item.URL.Host
+	return url.Host
 }
 
-// endpointKeyFunction a function used for deriving a key from a WeightedEndpointStatus that uniquely identifies it
-func endpointKeyFunction(obj interface{}) string {
-	item := obj.(*WeightedEndpointStatus)
-	if item.url == nil {
+// SchemeHostEndpointKey identifies endpoints by the scheme, the host and the port,
+// use it when the same host serves different backends for http and https
+func SchemeHostEndpointKey(url *url.URL, _ string) string {
+	if url == nil || len(url.Host) == 0 {
 		return ""
 	}
-	return item.url.Host
+	return url.Scheme + "://" + url.Host
+}
+
+// HostPathPrefixEndpointKey returns an EndpointKeyFunc that identifies endpoints by the host, the port and the given number of leading path segments,
+// use it when a host serves several backends under different path prefixes
+func HostPathPrefixEndpointKey(segments int) EndpointKeyFunc {
+	return func(url *url.URL, _ string) string {
+		if url == nil || len(url.Host) == 0 {
+			return ""
+		}
+		path := strings.TrimPrefix(url.Path, "/")
+		prefix := ""
+		for i := 0; i < segments && len(path) > 0; i++ {
+			segment := path
+			if idx := strings.IndexByte(path, '/'); idx >= 0 {
+				segment, path = path[:idx], path[idx+1:]
+			} else {
+				path = ""
+			}
+			prefix += "/" + segment
+		}
+		return url.Host + prefix
+	}
+}
+
+// EndpointIDKey identifies endpoints by the ID set explicitly on EndpointSample (EndpointSample.EndpointID)
+func EndpointIDKey(_ *url.URL, endpointID string) string {
+	return endpointID
 }
 
 const (
@@ -0,0 +1,212 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	fd "github.com/p0lyn0mial/failure-detector"
+)
+
+// EndpointRegistry is implemented by the failure detector, it accepts the endpoints of Services
+type EndpointRegistry interface {
+	// SetEndpointsWithConditions registers the given endpoints as the only endpoints of the given Service
+	SetEndpointsWithConditions(namespace, service string, endpoints []fd.RegisteredEndpoint)
+
+	// RemoveService deregisters the given Service and drops all data collected for it
+	RemoveService(namespace, service string)
+}
+
+// EndpointSliceAdapterOptions configures how EndpointSlices are converted to endpoints
+type EndpointSliceAdapterOptions struct {
+	// PortName selects the port of the EndpointSlice used for building URLs, the first port is used when empty
+	PortName string
+
+	// Scheme is used for building URLs, when empty it is derived from the port's appProtocol or name, falling back to "https"
+	Scheme string
+}
+
+// EndpointSliceAdapter watches EndpointSlices and keeps the endpoints registered with the failure detector in sync
+type EndpointSliceAdapter struct {
+	registry EndpointRegistry
+	options  EndpointSliceAdapterOptions
+
+	lister       discoverylisters.EndpointSliceLister
+	cachesSynced cache.InformerSynced
+
+	// queue holds keys (Namespace/Service) of Services that need to be synced
+	queue workqueue.RateLimitingInterface
+}
+
+// NewEndpointSliceAdapter creates an adapter that registers endpoints derived from EndpointSlices observed by the given shared informer
+func NewEndpointSliceAdapter(registry EndpointRegistry, informer discoveryinformers.EndpointSliceInformer, options EndpointSliceAdapterOptions) *EndpointSliceAdapter {
+	a := &EndpointSliceAdapter{
+		registry:     registry,
+		options:      options,
+		lister:       informer.Lister(),
+		cachesSynced: informer.Informer().HasSynced,
+		queue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "FailureDetectorEndpointSlices"),
+	}
+
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    a.enqueue,
+		UpdateFunc: func(_, obj interface{}) { a.enqueue(obj) },
+		DeleteFunc: a.enqueue,
+	})
+	return a
+}
+
+// Run starts the given number of workers and blocks until the given context is done
+func (a *EndpointSliceAdapter) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer a.queue.ShutDown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), a.cachesSynced) {
+		utilruntime.HandleError(fmt.Errorf("unable to sync EndpointSlices caches"))
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(a.worker, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+// enqueue adds the key of the Service that owns the given EndpointSlice to the queue
+func (a *EndpointSliceAdapter) enqueue(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type %T", obj))
+		return
+	}
+	service := slice.Labels[discoveryv1.LabelServiceName]
+	if len(service) == 0 {
+		// the slice is not managed on behalf of a Service
+		return
+	}
+	a.queue.Add(slice.Namespace + "/" + service)
+}
+
+func (a *EndpointSliceAdapter) worker() {
+	for a.processNextWorkItem() {
+	}
+}
+
+func (a *EndpointSliceAdapter) processNextWorkItem() bool {
+	key, quit := a.queue.Get()
+	if quit {
+		return false
+	}
+	defer a.queue.Done(key)
+
+	if err := a.sync(key.(string)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to sync %v: %v", key, err))
+		a.queue.AddRateLimited(key)
+		return true
+	}
+	a.queue.Forget(key)
+	return true
+}
+
+// sync registers endpoints of all EndpointSlices of the given Service, a Service without slices is removed from the detector
+func (a *EndpointSliceAdapter) sync(key string) error {
+	namespace, service, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service})
+	slices, err := a.lister.EndpointSlices(namespace).List(selector)
+	if errors.IsNotFound(err) || (err == nil && len(slices) == 0) {
+		a.registry.RemoveService(namespace, service)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	a.registry.SetEndpointsWithConditions(namespace, service, a.toEndpoints(slices))
+	return nil
+}
+
+// toEndpoints converts the given slices to endpoints, an endpoint that appears in many slices is ready if any slice says so
+func (a *EndpointSliceAdapter) toEndpoints(slices []*discoveryv1.EndpointSlice) []fd.RegisteredEndpoint {
+	byHost := map[string]int{}
+	endpoints := []fd.RegisteredEndpoint{}
+
+	for _, slice := range slices {
+		port, found := a.selectPort(slice)
+		if !found {
+			continue
+		}
+		scheme := a.scheme(port)
+
+		for _, sliceEndpoint := range slice.Endpoints {
+			// an unknown readiness should be interpreted as ready, see discoveryv1.EndpointConditions
+			ready := sliceEndpoint.Conditions.Ready == nil || *sliceEndpoint.Conditions.Ready
+			terminating := sliceEndpoint.Conditions.Terminating != nil && *sliceEndpoint.Conditions.Terminating
+
+			for _, address := range sliceEndpoint.Addresses {
+				host := net.JoinHostPort(address, strconv.Itoa(int(*port.Port)))
+				if idx, ok := byHost[host]; ok {
+					if ready && !terminating {
+						endpoints[idx].Ready = true
+						endpoints[idx].Terminating = false
+					}
+					continue
+				}
+				byHost[host] = len(endpoints)
+				endpoints = append(endpoints, fd.RegisteredEndpoint{
+					URL:         &url.URL{Scheme: scheme, Host: host},
+					Ready:       ready,
+					Terminating: terminating,
+				})
+			}
+		}
+	}
+
+	return endpoints
+}
+
+// selectPort returns the port configured via options or the first port of the slice
+func (a *EndpointSliceAdapter) selectPort(slice *discoveryv1.EndpointSlice) (discoveryv1.EndpointPort, bool) {
+	for _, port := range slice.Ports {
+		if port.Port == nil {
+			continue
+		}
+		if len(a.options.PortName) == 0 || (port.Name != nil && *port.Name == a.options.PortName) {
+			return port, true
+		}
+	}
+	return discoveryv1.EndpointPort{}, false
+}
+
+// scheme returns the scheme configured via options or derives it from the given port
+func (a *EndpointSliceAdapter) scheme(port discoveryv1.EndpointPort) string {
+	if len(a.options.Scheme) > 0 {
+		return a.options.Scheme
+	}
+	for _, candidate := range []*string{port.AppProtocol, port.Name} {
+		if candidate != nil && (*candidate == "http" || *candidate == "https") {
+			return *candidate
+		}
+	}
+	return "https"
+}
@@ -0,0 +1,184 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	fd "github.com/p0lyn0mial/failure-detector"
+)
+
+func TestEndpointSliceAdapter(t *testing.T) {
+	scenarios := []struct {
+		name              string
+		options           EndpointSliceAdapterOptions
+		initialSlices     []*discoveryv1.EndpointSlice
+		updatedSlices     []*discoveryv1.EndpointSlice
+		deletedSlices     []*discoveryv1.EndpointSlice
+		expectedEndpoints map[string][]string
+	}{
+		{
+			name: "endpoints of a Service are registered along with their conditions",
+			initialSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379,
+					newSliceEndpoint("10.0.0.1", true, false),
+					newSliceEndpoint("10.0.0.2", false, false),
+					newSliceEndpoint("10.0.0.3", false, true)),
+			},
+			expectedEndpoints: map[string][]string{
+				"ns/etcd": {"https://10.0.0.1:2379 ready", "https://10.0.0.2:2379 not-ready", "https://10.0.0.3:2379 not-ready terminating"},
+			},
+		},
+		{
+			name: "endpoints of many slices are merged, the selected port and scheme are used",
+			options: EndpointSliceAdapterOptions{
+				PortName: "metrics",
+				Scheme:   "http",
+			},
+			initialSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379, newSliceEndpoint("10.0.0.1", true, false)),
+				newSlice("etcd-2", "etcd", "metrics", 9090, newSliceEndpoint("10.0.0.2", true, false)),
+				newSlice("etcd-3", "etcd", "metrics", 9090, newSliceEndpoint("10.0.0.3", true, false)),
+			},
+			expectedEndpoints: map[string][]string{
+				"ns/etcd": {"http://10.0.0.2:9090 ready", "http://10.0.0.3:9090 ready"},
+			},
+		},
+		{
+			name: "updates are propagated",
+			initialSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379, newSliceEndpoint("10.0.0.1", true, false)),
+			},
+			updatedSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379, newSliceEndpoint("10.0.0.2", true, false)),
+			},
+			expectedEndpoints: map[string][]string{
+				"ns/etcd": {"https://10.0.0.2:2379 ready"},
+			},
+		},
+		{
+			name: "a Service without slices is removed",
+			initialSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379, newSliceEndpoint("10.0.0.1", true, false)),
+				newSlice("api-1", "api", "https", 6443, newSliceEndpoint("10.0.0.2", true, false)),
+			},
+			deletedSlices: []*discoveryv1.EndpointSlice{
+				newSlice("etcd-1", "etcd", "https", 2379),
+			},
+			expectedEndpoints: map[string][]string{
+				"ns/api": {"https://10.0.0.2:6443 ready"},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+
+			client := fake.NewSimpleClientset()
+			for _, slice := range scenario.initialSlices {
+				if _, err := client.DiscoveryV1().EndpointSlices(slice.Namespace).Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			registry := &fakeEndpointRegistry{endpoints: map[string][]string{}}
+			informerFactory := informers.NewSharedInformerFactory(client, 0)
+			target := NewEndpointSliceAdapter(registry, informerFactory.Discovery().V1().EndpointSlices(), scenario.options)
+			informerFactory.Start(ctx.Done())
+			go target.Run(ctx, 1)
+
+			for _, slice := range scenario.updatedSlices {
+				if _, err := client.DiscoveryV1().EndpointSlices(slice.Namespace).Update(ctx, slice, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, slice := range scenario.deletedSlices {
+				if err := client.DiscoveryV1().EndpointSlices(slice.Namespace).Delete(ctx, slice.Name, metav1.DeleteOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := wait.Poll(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+				return reflect.DeepEqual(registry.get(), scenario.expectedEndpoints), nil
+			})
+			if err != nil {
+				t.Fatalf("expected %v registered endpoints, got %v", scenario.expectedEndpoints, registry.get())
+			}
+		})
+	}
+}
+
+type fakeEndpointRegistry struct {
+	lock      sync.Mutex
+	endpoints map[string][]string
+}
+
+func (r *fakeEndpointRegistry) SetEndpointsWithConditions(namespace, service string, endpoints []fd.RegisteredEndpoint) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	serialized := []string{}
+	for _, endpoint := range endpoints {
+		entry := endpoint.URL.String()
+		if endpoint.Ready {
+			entry += " ready"
+		} else {
+			entry += " not-ready"
+		}
+		if endpoint.Terminating {
+			entry += " terminating"
+		}
+		serialized = append(serialized, entry)
+	}
+	sort.Strings(serialized)
+	r.endpoints[namespace+"/"+service] = serialized
+}
+
+func (r *fakeEndpointRegistry) RemoveService(namespace, service string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.endpoints, namespace+"/"+service)
+}
+
+func (r *fakeEndpointRegistry) get() map[string][]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := map[string][]string{}
+	for key, endpoints := range r.endpoints {
+		ret[key] = endpoints
+	}
+	return ret
+}
+
+func newSlice(name, service, portName string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	protocol := corev1.ProtocolTCP
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port, Protocol: &protocol}},
+	}
+}
+
+func newSliceEndpoint(address string, ready, terminating bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{address},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready, Terminating: &terminating},
+	}
+}
@@ -0,0 +1,48 @@
+package k8s
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	fd "github.com/p0lyn0mial/failure-detector"
+)
+
+const (
+	// EventReasonEndpointEjected is used for events recorded when an endpoint becomes unhealthy
+	EventReasonEndpointEjected = "EndpointEjected"
+
+	// EventReasonEndpointRecovered is used for events recorded when an endpoint becomes healthy again
+	EventReasonEndpointRecovered = "EndpointRecovered"
+)
+
+// EventSink records Kubernetes Events against the Service that owns an endpoint when the endpoint gets ejected or recovers.
+// Its Handle method can be passed to the detector via failure_detector.WithTransitionHandler
+type EventSink struct {
+	recorder record.EventRecorder
+}
+
+// NewEventSink creates an EventSink that records events through the given recorder
+func NewEventSink(recorder record.EventRecorder) *EventSink {
+	return &EventSink{recorder: recorder}
+}
+
+// Handle records an event for the given transition
+func (s *EventSink) Handle(transition fd.EndpointTransition) {
+	serviceRef := &corev1.ObjectReference{
+		Kind:       "Service",
+		APIVersion: "v1",
+		Namespace:  transition.Namespace,
+		Name:       transition.Service,
+	}
+
+	endpoint := ""
+	if transition.URL != nil {
+		endpoint = transition.URL.Host
+	}
+
+	if len(transition.NewStatus) > 0 {
+		s.recorder.Eventf(serviceRef, corev1.EventTypeWarning, EventReasonEndpointEjected, "Endpoint %s ejected: %s (weight %.2f)", endpoint, transition.NewStatus, transition.Weight)
+		return
+	}
+	s.recorder.Eventf(serviceRef, corev1.EventTypeNormal, EventReasonEndpointRecovered, "Endpoint %s recovered from %s (weight %.2f)", endpoint, transition.OldStatus, transition.Weight)
+}
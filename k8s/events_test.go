@@ -0,0 +1,48 @@
+package k8s
+
+import (
+	"net/url"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	fd "github.com/p0lyn0mial/failure-detector"
+)
+
+func TestEventSink(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "10.0.0.1:2379"}
+	scenarios := []struct {
+		name          string
+		transition    fd.EndpointTransition
+		expectedEvent string
+	}{
+		{
+			name:          "ejection",
+			transition:    fd.EndpointTransition{Namespace: "ns", Service: "etcd", URL: endpoint, NewStatus: fd.EndpointStatusReasonTooManyErrors},
+			expectedEvent: "Warning EndpointEjected Endpoint 10.0.0.1:2379 ejected: TooManyErrors (weight 0.00)",
+		},
+		{
+			name:          "recovery",
+			transition:    fd.EndpointTransition{Namespace: "ns", Service: "etcd", URL: endpoint, OldStatus: fd.EndpointStatusReasonTooManyErrors, Weight: 0.1},
+			expectedEvent: "Normal EndpointRecovered Endpoint 10.0.0.1:2379 recovered from TooManyErrors (weight 0.10)",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			target := NewEventSink(recorder)
+
+			target.Handle(scenario.transition)
+
+			select {
+			case event := <-recorder.Events:
+				if event != scenario.expectedEvent {
+					t.Fatalf("expected %q event but got %q", scenario.expectedEvent, event)
+				}
+			default:
+				t.Fatal("expected an event to be recorded")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package failure_detector
+
+import (
+	"math"
+	"time"
+)
+
+// LatencyPercentiles holds latency percentiles of the recent requests of an endpoint, zero means no latency has been recorded
+type LatencyPercentiles struct {
+	P50  time.Duration `json:"p50"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+}
+
+const (
+	// latencySketchMin is the lowest latency the sketch distinguishes, lower latencies are accounted as latencySketchMin
+	latencySketchMin = time.Microsecond
+
+	// latencySketchBucketsPerDoubling gives a relative error of 2^(1/16)-1 (about 4.4%)
+	latencySketchBucketsPerDoubling = 8
+
+	// latencySketchBuckets covers latencies up to about 18 minutes (2^30 microseconds), higher latencies are accounted in the last bucket
+	latencySketchBuckets = 30 * latencySketchBucketsPerDoubling
+
+	// latencySketchHalfLife is the time after which recorded latencies count half as much as new ones
+	latencySketchHalfLife = time.Minute
+
+	// latencyPublishInterval bounds how often percentiles alone (without a change of the status or the weight) are published to readers
+	latencyPublishInterval = time.Second
+)
+
+// latencySketch is a streaming quantile sketch with logarithmically sized buckets (HDR-style).
+// It uses constant memory regardless of the number of recorded latencies, old latencies decay so that the percentiles follow recent requests
+type latencySketch struct {
+	counts [latencySketchBuckets]float32
+	total  float64
+
+	// decayedAt is the time the counts were last halved
+	decayedAt time.Time
+
+	// publishedAt is the time the percentiles were last published to readers
+	publishedAt time.Time
+}
+
+// add records the given latency observed at the given time, count is the number of requests the latency stands for
+func (s *latencySketch) add(latency time.Duration, timestamp time.Time, count float64) {
+	s.decay(timestamp)
+
+	index := 0
+	if latency > latencySketchMin {
+		index = int(math.Log2(float64(latency)/float64(latencySketchMin)) * latencySketchBucketsPerDoubling)
+	}
+	if index >= latencySketchBuckets {
+		index = latencySketchBuckets - 1
+	}
+	s.counts[index] += float32(count)
+	s.total += count
+}
+
+// decay halves the counts for every half-life that has passed since the last decay
+func (s *latencySketch) decay(now time.Time) {
+	if s.decayedAt.IsZero() {
+		s.decayedAt = now
+		return
+	}
+	halfLives := int(now.Sub(s.decayedAt) / latencySketchHalfLife)
+	if halfLives <= 0 {
+		return
+	}
+	s.decayedAt = s.decayedAt.Add(time.Duration(halfLives) * latencySketchHalfLife)
+	if halfLives > 32 {
+		// the counts are negligible
+		s.counts = [latencySketchBuckets]float32{}
+		s.total = 0
+		return
+	}
+
+	factor := math.Pow(0.5, float64(halfLives))
+	s.total = 0
+	for i := range s.counts {
+		s.counts[i] *= float32(factor)
+		s.total += float64(s.counts[i])
+	}
+}
+
+// quantile returns the latency below which the given fraction of the recorded requests falls,
+// the value is the geometric middle of the bucket that holds the quantile
+func (s *latencySketch) quantile(q float64) time.Duration {
+	if s.total <= 0 {
+		return 0
+	}
+
+	rank := q * s.total
+	cumulative := 0.0
+	index := latencySketchBuckets - 1
+	for i, count := range s.counts {
+		cumulative += float64(count)
+		if count > 0 && cumulative >= rank {
+			index = i
+			break
+		}
+	}
+	return time.Duration(float64(latencySketchMin) * math.Exp2((float64(index)+0.5)/latencySketchBucketsPerDoubling))
+}
+
+// percentiles returns p50, p99 and p999 of the recorded latencies
+func (s *latencySketch) percentiles() LatencyPercentiles {
+	return LatencyPercentiles{P50: s.quantile(0.5), P99: s.quantile(0.99), P999: s.quantile(0.999)}
+}
+
+// LatencyQuantile returns the latency below which the given fraction (e.g. 0.99) of the recent requests of the endpoint falls,
+// the estimate is within about 5% of the actual value. It returns false when no latency has been recorded for the endpoint
+func (ep *WeightedEndpointStatus) LatencyQuantile(q float64) (time.Duration, bool) {
+	if ep.latency == nil || ep.latency.total <= 0 {
+		return 0, false
+	}
+	return ep.latency.quantile(q), true
+}
+
+// LatencyPercentiles returns p50, p99 and p999 of the recent requests of the endpoint, see LatencyQuantile
+func (ep *WeightedEndpointStatus) LatencyPercentiles() (LatencyPercentiles, bool) {
+	if ep.latency == nil || ep.latency.total <= 0 {
+		return LatencyPercentiles{}, false
+	}
+	return ep.latency.percentiles(), true
+}
@@ -0,0 +1,121 @@
+package failure_detector
+
+import (
+	"math"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestLatencySketch(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	uniform := func(sketch *latencySketch, timestamp time.Time, from, to time.Duration) {
+		for latency := from; latency <= to; latency += (to - from) / 10000 {
+			sketch.add(latency, timestamp, 1)
+		}
+	}
+
+	scenarios := []struct {
+		name                string
+		recordFn            func(sketch *latencySketch)
+		expectedPercentiles LatencyPercentiles
+	}{
+		{
+			name:     "uniform latencies",
+			recordFn: func(sketch *latencySketch) { uniform(sketch, now, time.Millisecond, time.Second) },
+			expectedPercentiles: LatencyPercentiles{
+				P50:  500 * time.Millisecond,
+				P99:  990 * time.Millisecond,
+				P999: 999 * time.Millisecond,
+			},
+		},
+		{
+			name: "a slow tail",
+			recordFn: func(sketch *latencySketch) {
+				for i := 0; i < 990; i++ {
+					sketch.add(10*time.Millisecond, now, 1)
+				}
+				sketch.add(2*time.Second, now, 10)
+			},
+			expectedPercentiles: LatencyPercentiles{P50: 10 * time.Millisecond, P99: 10 * time.Millisecond, P999: 2 * time.Second},
+		},
+		{
+			name: "out of range latencies",
+			recordFn: func(sketch *latencySketch) {
+				sketch.add(time.Nanosecond, now, 1)
+				sketch.add(time.Hour, now, 1)
+			},
+			expectedPercentiles: LatencyPercentiles{P50: latencySketchMin, P99: 17 * time.Minute, P999: 17 * time.Minute},
+		},
+		{
+			name: "old latencies decay",
+			recordFn: func(sketch *latencySketch) {
+				uniform(sketch, now, time.Millisecond, 10*time.Millisecond)
+				uniform(sketch, now.Add(10*latencySketchHalfLife), time.Second, time.Second+time.Millisecond)
+			},
+			expectedPercentiles: LatencyPercentiles{P50: time.Second, P99: time.Second, P999: time.Second},
+		},
+		{
+			name: "latencies older than 32 half-lives are dropped",
+			recordFn: func(sketch *latencySketch) {
+				sketch.add(time.Millisecond, now, 1)
+				sketch.decay(now.Add(33 * latencySketchHalfLife))
+			},
+		},
+	}
+
+	within := func(actual, expected time.Duration) bool {
+		return math.Abs(float64(actual-expected)) <= 0.05*float64(expected)
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			sketch := &latencySketch{}
+			scenario.recordFn(sketch)
+			actual := sketch.percentiles()
+			if !within(actual.P50, scenario.expectedPercentiles.P50) || !within(actual.P99, scenario.expectedPercentiles.P99) || !within(actual.P999, scenario.expectedPercentiles.P999) {
+				t.Fatalf("expected %+v percentiles (within 5%%) but got %+v", scenario.expectedPercentiles, actual)
+			}
+		})
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	target := NewDefaultFailureDetector(WithClock(fakeClock))
+	withLatency := func(latency time.Duration) []*EndpointSample {
+		samples := genSamples(endpoint, 100, false)
+		for _, endpointSample := range samples {
+			endpointSample.Latency = latency
+		}
+		return samples
+	}
+
+	target.processBatch(withLatency(10 * time.Millisecond))
+	if details := target.EndpointStatusDetails("ns", "etcd", endpoint); details.Latency.P50 < 9*time.Millisecond || details.Latency.P50 > 11*time.Millisecond {
+		t.Fatalf("expected p50 of about 10ms, got %+v", details.Latency)
+	}
+	endpointsStore, _ := target.store.Get(serviceName{namespace: "ns", service: "etcd"})
+	storedEndpoint, _ := endpointsStore.Get(endpoint.Host)
+	if p99, ok := storedEndpoint.LatencyQuantile(0.99); !ok || p99 < 9*time.Millisecond || p99 > 11*time.Millisecond {
+		t.Fatalf("expected p99 of about 10ms to be available to policies, got %v", p99)
+	}
+
+	// the percentiles seen by readers are refreshed at most once a second
+	target.processBatch(withLatency(time.Second))
+	if details := target.EndpointStatusDetails("ns", "etcd", endpoint); details.Latency.P50 > 11*time.Millisecond {
+		t.Fatalf("expected the percentiles not to be refreshed yet, got %+v", details.Latency)
+	}
+	fakeClock.Step(latencyPublishInterval)
+	target.processBatch(withLatency(time.Second))
+	latency := target.Snapshot().Services[0].Endpoints[0].Latency
+	if latency.P50 < 950*time.Millisecond || latency.P999 > 1050*time.Millisecond {
+		t.Fatalf("expected p50 and p999 of about 1s, got %+v", latency)
+	}
+
+	if _, ok := newWeightedEndpoint(defaultWindowSize, endpoint).LatencyPercentiles(); ok {
+		t.Fatal("expected no percentiles without recorded latencies")
+	}
+}
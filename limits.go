@@ -0,0 +1,149 @@
+package failure_detector
+
+import (
+	"net/url"
+	"sync/atomic"
+)
+
+// Limits bounds the memory used by the detector, a zero value means no limit.
+// When a limit is exceeded the least recently updated data is evicted
+type Limits struct {
+	// MaxServices the max number of Services tracked at the same time
+	MaxServices int
+
+	// MaxEndpointsPerService the max number of endpoints tracked per Service
+	MaxEndpointsPerService int
+
+	// MaxSamples the max number of samples held across all endpoints,
+	// note that an endpoint reserves room for the whole window of samples (see WithWindowSize) as soon as it is tracked,
+	// time-windowed endpoints (see WithTimeWindow) account for one sample per bucket
+	MaxSamples int
+}
+
+// EvictionReason describes which limit caused an eviction
+type EvictionReason string
+
+const (
+	EvictionReasonServiceLimit  EvictionReason = "ServiceLimit"
+	EvictionReasonEndpointLimit EvictionReason = "EndpointLimit"
+	EvictionReasonSampleLimit   EvictionReason = "SampleLimit"
+)
+
+// Eviction describes an endpoint whose data has been removed because a limit has been exceeded
+type Eviction struct {
+	Namespace string
+	Service   string
+	URL       *url.URL
+	Reason    EvictionReason
+}
+
+// EvictionFunc a function notified when an endpoint is evicted, it is called synchronously by the worker and must not block
+type EvictionFunc func(eviction Eviction)
+
+// WithLimits bounds the number of Services, endpoints and samples tracked by the detector
+func WithLimits(limits Limits) Option {
+	return func(fd *failureDetector) {
+		fd.limits = limits
+	}
+}
+
+// WithEvictionHandler sets a function that is notified when an endpoint is evicted because of the configured Limits
+func WithEvictionHandler(fn EvictionFunc) Option {
+	return func(fd *failureDetector) {
+		fd.evictionFn = fn
+	}
+}
+
+// EvictedEndpoints returns the number of endpoints evicted so far because of the configured Limits
+func (fd *failureDetector) EvictedEndpoints() uint64 {
+	return atomic.LoadUint64(&fd.evictedEndpoints)
+}
+
+// enforceLimits evicts the least recently updated data until the store fits the configured limits.
+// Only the endpoints of the given Service are checked against MaxEndpointsPerService as that is the Service that might have grown.
+// It returns the Services that have changed, must be called with fd.lock held
+func (fd *failureDetector) enforceLimits(grownService serviceName) []serviceName {
+	changedServices := []serviceName{}
+
+	if endpointsStore, ok := fd.store.Get(grownService); ok && fd.limits.MaxEndpointsPerService > 0 {
+		evicted := false
+		for endpointsStore.Len() > fd.limits.MaxEndpointsPerService {
+			fd.evictOldestEndpoint(grownService, endpointsStore, EvictionReasonEndpointLimit)
+			evicted = true
+		}
+		if evicted {
+			changedServices = append(changedServices, grownService)
+		}
+	}
+
+	for fd.limits.MaxServices > 0 && fd.store.Len() > fd.limits.MaxServices {
+		name, endpointsStore, _ := fd.store.Oldest()
+		for endpointsStore.Len() > 0 {
+			fd.evictOldestEndpoint(name, endpointsStore, EvictionReasonServiceLimit)
+		}
+		fd.store.Delete(name)
+		changedServices = append(changedServices, name)
+	}
+
+	for fd.limits.MaxSamples > 0 && fd.trackedEndpoints*fd.samplesPerEndpoint() > fd.limits.MaxSamples {
+		// finding the least recently updated endpoint across all Services would be expensive,
+		// the oldest endpoint of the least recently updated Service is a good approximation
+		name, endpointsStore, ok := fd.store.Oldest()
+		if !ok {
+			break
+		}
+		if endpointsStore.Len() > 0 {
+			fd.evictOldestEndpoint(name, endpointsStore, EvictionReasonSampleLimit)
+		}
+		if endpointsStore.Len() == 0 {
+			fd.store.Delete(name)
+		}
+		changedServices = append(changedServices, name)
+	}
+
+	return changedServices
+}
+
+// samplesPerEndpoint returns the number of samples (or buckets) an endpoint reserves room for
+func (fd *failureDetector) samplesPerEndpoint() int {
+	if fd.timeWindow > 0 {
+		return timeWindowBuckets(fd.timeWindow, fd.timeWindowBucket)
+	}
+	return fd.windowSize
+}
+
+// evictOldestEndpoint removes the least recently updated endpoint of the given Service and reports the eviction
+func (fd *failureDetector) evictOldestEndpoint(name serviceName, endpointsStore *WeightedEndpointStatusStore, reason EvictionReason) {
+	endpointKey, endpoint, ok := endpointsStore.Oldest()
+	if !ok {
+		return
+	}
+	endpointsStore.Delete(endpointKey)
+	fd.trackedEndpoints--
+	atomic.AddUint64(&fd.evictedEndpoints, 1)
+	if fd.evictionFn != nil {
+		fd.evictionFn(Eviction{Namespace: name.namespace, Service: name.service, URL: endpoint.url, Reason: reason})
+	}
+}
+
+// removeExpired removes endpoints that stopped receiving samples and Services that don't have any endpoints left,
+// the changes are published to the read-only store
+func (fd *failureDetector) removeExpired() {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	changedServices := []serviceName{}
+	for _, name := range fd.store.Keys() {
+		endpointsStore, _ := fd.store.Get(name)
+		before := endpointsStore.Len()
+		endpointsStore.RemoveExpired()
+		fd.trackedEndpoints -= before - endpointsStore.Len()
+		if endpointsStore.Len() == 0 {
+			fd.store.Delete(name)
+		}
+		if before != endpointsStore.Len() || endpointsStore.Len() == 0 {
+			changedServices = append(changedServices, name)
+		}
+	}
+	fd.propagateChangesToReadOnlyStore(changedServices...)
+}
@@ -0,0 +1,165 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestLimits(t *testing.T) {
+	sample := func(service string, host int) *EndpointSample {
+		return &EndpointSample{Namespace: "ns", Service: service, URL: &url.URL{Scheme: "https", Host: fmt.Sprintf("10.0.0.%d:443", host)}}
+	}
+	scenarios := []struct {
+		name              string
+		limits            Limits
+		samples           []*EndpointSample
+		expectedEvictions []string
+		expectedEndpoints map[string][]string
+	}{
+		{
+			name:              "no limits",
+			samples:           []*EndpointSample{sample("a", 1), sample("a", 2), sample("b", 1)},
+			expectedEndpoints: map[string][]string{"a": {"10.0.0.1:443", "10.0.0.2:443"}, "b": {"10.0.0.1:443"}},
+		},
+		{
+			name:              "the least recently updated endpoint of a Service is evicted",
+			limits:            Limits{MaxEndpointsPerService: 2},
+			samples:           []*EndpointSample{sample("a", 1), sample("a", 2), sample("a", 1), sample("a", 3), sample("b", 1)},
+			expectedEvictions: []string{"ns/a/10.0.0.2:443/EndpointLimit"},
+			expectedEndpoints: map[string][]string{"a": {"10.0.0.1:443", "10.0.0.3:443"}, "b": {"10.0.0.1:443"}},
+		},
+		{
+			name:              "the least recently updated Service is evicted",
+			limits:            Limits{MaxServices: 2},
+			samples:           []*EndpointSample{sample("a", 1), sample("a", 2), sample("b", 1), sample("a", 1), sample("c", 1)},
+			expectedEvictions: []string{"ns/b/10.0.0.1:443/ServiceLimit"},
+			expectedEndpoints: map[string][]string{"a": {"10.0.0.1:443", "10.0.0.2:443"}, "c": {"10.0.0.1:443"}},
+		},
+		{
+			name:              "endpoints of the least recently updated Service are evicted to fit the samples",
+			limits:            Limits{MaxSamples: 3 * defaultWindowSize},
+			samples:           []*EndpointSample{sample("a", 1), sample("a", 2), sample("b", 1), sample("b", 2)},
+			expectedEvictions: []string{"ns/a/10.0.0.1:443/SampleLimit"},
+			expectedEndpoints: map[string][]string{"a": {"10.0.0.2:443"}, "b": {"10.0.0.1:443", "10.0.0.2:443"}},
+		},
+		{
+			name:              "a Service without endpoints left is removed",
+			limits:            Limits{MaxSamples: 2 * defaultWindowSize},
+			samples:           []*EndpointSample{sample("a", 1), sample("b", 1), sample("c", 1)},
+			expectedEvictions: []string{"ns/a/10.0.0.1:443/SampleLimit"},
+			expectedEndpoints: map[string][]string{"b": {"10.0.0.1:443"}, "c": {"10.0.0.1:443"}},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var actualEvictions []string
+			target := NewDefaultFailureDetector(WithLimits(scenario.limits), WithEvictionHandler(func(eviction Eviction) {
+				actualEvictions = append(actualEvictions, fmt.Sprintf("%s/%s/%s/%s", eviction.Namespace, eviction.Service, eviction.URL.Host, eviction.Reason))
+			}))
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			if !reflect.DeepEqual(actualEvictions, scenario.expectedEvictions) {
+				t.Fatalf("expected %v evictions but got %v", scenario.expectedEvictions, actualEvictions)
+			}
+			if target.EvictedEndpoints() != uint64(len(scenario.expectedEvictions)) {
+				t.Fatalf("expected %d evicted endpoints but got %d", len(scenario.expectedEvictions), target.EvictedEndpoints())
+			}
+			if actualEndpoints := storedEndpoints(target); !reflect.DeepEqual(actualEndpoints, scenario.expectedEndpoints) {
+				t.Fatalf("expected %v endpoints but got %v", scenario.expectedEndpoints, actualEndpoints)
+			}
+			expectedTrackedEndpoints := 0
+			for _, endpoints := range scenario.expectedEndpoints {
+				expectedTrackedEndpoints += len(endpoints)
+			}
+			if target.trackedEndpoints != expectedTrackedEndpoints {
+				t.Fatalf("expected %d tracked endpoints but got %d", expectedTrackedEndpoints, target.trackedEndpoints)
+			}
+		})
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	target := NewDefaultFailureDetector(WithClock(fakeClock))
+	expiringEndpoint := &url.URL{Scheme: "https", Host: "10.0.0.1:443"}
+	endpoint := &url.URL{Scheme: "https", Host: "10.0.0.2:443"}
+	target.processBatch(genSamples(expiringEndpoint, 100, true))
+	target.processBatch([]*EndpointSample{{Namespace: "ns", Service: "expiring", URL: expiringEndpoint}})
+
+	fakeClock.Step(defaultEndpointTTL / 2)
+	target.processBatch([]*EndpointSample{{Namespace: "ns", Service: "etcd", URL: endpoint}})
+	fakeClock.Step(defaultEndpointTTL/2 + time.Second)
+	target.removeExpired()
+
+	if actualEndpoints := storedEndpoints(target); !reflect.DeepEqual(actualEndpoints, map[string][]string{"etcd": {"10.0.0.2:443"}}) {
+		t.Fatalf("expected only the recently updated endpoint to be kept, got %v", actualEndpoints)
+	}
+	if target.trackedEndpoints != 1 {
+		t.Fatalf("expected 1 tracked endpoint but got %d", target.trackedEndpoints)
+	}
+	// the expired data is no longer published
+	if isHealthy, _ := target.EndpointStatus("ns", "etcd", expiringEndpoint); !isHealthy {
+		t.Fatal("expected the expired endpoint to be considered healthy")
+	}
+}
+
+func TestLimitsAfterExpiry(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	evictions := []Eviction{}
+	target := NewDefaultFailureDetector(WithClock(fakeClock), WithLimits(Limits{MaxSamples: 2 * defaultWindowSize}), WithMaxEjectionPercent(50), WithEvictionHandler(func(eviction Eviction) {
+		evictions = append(evictions, eviction)
+	}))
+	endpoint := func(host int) *url.URL {
+		return &url.URL{Scheme: "https", Host: fmt.Sprintf("10.0.0.%d:443", host)}
+	}
+	checkTrackedEndpoints := func() {
+		t.Helper()
+		stored := 0
+		for _, endpointsStore := range target.store.List() {
+			stored += endpointsStore.Len()
+		}
+		if target.trackedEndpoints != stored {
+			t.Fatalf("expected %d tracked endpoints but got %d", stored, target.trackedEndpoints)
+		}
+	}
+
+	target.processBatch([]*EndpointSample{{Namespace: "ns", Service: "etcd", URL: endpoint(1)}})
+	fakeClock.Step(defaultEndpointTTL + time.Second)
+
+	// reads (publishing, the ejection cap) must not remove the expired endpoint behind the counter's back
+	for _, endpointSample := range genSamples(endpoint(2), 10, true) {
+		target.processBatch([]*EndpointSample{endpointSample})
+		checkTrackedEndpoints()
+	}
+	target.processBatch([]*EndpointSample{{Namespace: "ns", Service: "etcd", URL: endpoint(3)}})
+	checkTrackedEndpoints()
+
+	if len(evictions) != 0 {
+		t.Fatalf("expected no evictions since the expired endpoint doesn't count against the limits, got %v", evictions)
+	}
+	if actualEndpoints := storedEndpoints(target); !reflect.DeepEqual(actualEndpoints, map[string][]string{"etcd": {"10.0.0.2:443", "10.0.0.3:443"}}) {
+		t.Fatalf("expected the endpoints that haven't expired to be kept, got %v", actualEndpoints)
+	}
+}
+
+// storedEndpoints returns the sorted keys of endpoints held by the store per Service
+func storedEndpoints(target *failureDetector) map[string][]string {
+	endpoints := map[string][]string{}
+	for _, name := range target.store.Keys() {
+		endpointsStore, _ := target.store.Get(name)
+		for _, endpoint := range endpointsStore.List() {
+			endpoints[name.service] = append(endpoints[name.service], endpointKeyFunction(endpoint))
+		}
+		sort.Strings(endpoints[name.service])
+	}
+	return endpoints
+}
@@ -0,0 +1,151 @@
+package failure_detector
+
+import (
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// PolicyWildcard matches any namespace or service in a PolicyRule
+const PolicyWildcard = "*"
+
+// PolicyRule assigns a policy to the Services matching the given namespace and service, either of them can be PolicyWildcard.
+// When more than one rule matches a Service the most specific one wins, rules with an exact namespace win over rules with an exact service.
+// Services that don't match any rule are assessed by the policy the detector has been created with
+type PolicyRule struct {
+	Namespace string
+	Service   string
+	Policy    EvaluateFunc
+
+	// RequiresSamples marks policies that read individual samples (see WeightedEndpointStatus.Get), directly or via combinators (e.g. NewEWMAPolicy).
+	// Such rules are rejected by detectors configured with WithTimeWindow since time-windowed endpoints keep only counters
+	RequiresSamples bool
+}
+
+// policies holds per-Service policy rules, they can be updated while the detector is running
+type policies struct {
+	rules *serviceMap[PolicyRule]
+}
+
+func newPolicies() *policies {
+	return &policies{rules: newServiceMap[PolicyRule]()}
+}
+
+// set assigns the given rule, a rule without a policy removes the rule
+func (p *policies) set(rule PolicyRule) {
+	if rule.Policy == nil {
+		p.rules.delete(rule.Namespace, rule.Service)
+		return
+	}
+	p.rules.set(rule.Namespace, rule.Service, rule)
+}
+
+// replace replaces all rules with the given ones
+func (p *policies) replace(rules []PolicyRule) {
+	updated := map[string]map[string]PolicyRule{}
+	for _, rule := range rules {
+		if rule.Policy == nil {
+			continue
+		}
+		if updated[rule.Namespace] == nil {
+			updated[rule.Namespace] = map[string]PolicyRule{}
+		}
+		updated[rule.Namespace][rule.Service] = rule
+	}
+	p.rules.replace(updated)
+}
+
+// list returns all rules
+func (p *policies) list() []PolicyRule {
+	rules := []PolicyRule{}
+	for _, services := range p.rules.load() {
+		for _, rule := range services {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// get returns the policy of the most specific rule matching the given Service or nil if no rule matches
+func (p *policies) get(namespace, service string) EvaluateFunc {
+	rules := p.rules.load()
+	if len(rules) == 0 {
+		return nil
+	}
+	if rule, ok := rules[namespace][service]; ok {
+		return rule.Policy
+	}
+	if rule, ok := rules[namespace][PolicyWildcard]; ok {
+		return rule.Policy
+	}
+	if rule, ok := rules[PolicyWildcard][service]; ok {
+		return rule.Policy
+	}
+	return rules[PolicyWildcard][PolicyWildcard].Policy
+}
+
+// WithPolicies assigns the given rules to the detector like SetPolicies,
+// the rules are validated once all options have been applied (see NewDefaultFailureDetector)
+func WithPolicies(rules []PolicyRule) Option {
+	return func(fd *failureDetector) {
+		fd.policies.replace(rules)
+	}
+}
+
+// SetPolicy assigns the policy of the given rule to the matching Services (see PolicyRule), a rule without a policy removes the rule.
+// Endpoints keep their current status and weight, the new policy applies to the samples processed from now on.
+// A rule that doesn't fit the detector (see PolicyRule.RequiresSamples) is rejected and the current rule is kept.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetPolicy(rule PolicyRule) error {
+	if err := fd.validatePolicyRule(rule); err != nil {
+		return err
+	}
+	fd.policies.set(rule)
+	return nil
+}
+
+// SetPolicies replaces all rules set so far with the given ones.
+// When any of the rules doesn't fit the detector (see PolicyRule.RequiresSamples) none of them is applied and the current rules are kept.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetPolicies(rules []PolicyRule) error {
+	errs := []error{}
+	for _, rule := range rules {
+		if err := fd.validatePolicyRule(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	fd.policies.replace(rules)
+	return nil
+}
+
+// validatePolicyRule checks that the given rule fits the detector
+func (fd *failureDetector) validatePolicyRule(rule PolicyRule) error {
+	if rule.Policy != nil && rule.RequiresSamples && fd.timeWindow > 0 {
+		return fmt.Errorf("the policy for %s/%s requires individual samples which time-windowed endpoints (WithTimeWindow) don't keep", rule.Namespace, rule.Service)
+	}
+	return nil
+}
+
+// removeInvalidPolicyRules removes the rules that don't fit the detector, it is called once all options have been applied
+// since the options that assign rules and the ones that configure the detector can come in any order
+func (fd *failureDetector) removeInvalidPolicyRules() error {
+	errs := []error{}
+	for _, rule := range fd.policies.list() {
+		if err := fd.validatePolicyRule(rule); err != nil {
+			errs = append(errs, err)
+			fd.policies.set(PolicyRule{Namespace: rule.Namespace, Service: rule.Service})
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// policyFor returns the policy that assesses the endpoints of the given Service
+func (fd *failureDetector) policyFor(namespace, service string) EvaluateFunc {
+	if policy := fd.policies.get(namespace, service); policy != nil {
+		return policy
+	}
+	return fd.policyEvaluatorFn
+}
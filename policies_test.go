@@ -0,0 +1,127 @@
+package failure_detector
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPolicyRules(t *testing.T) {
+	policyNamed := func(name string) EvaluateFunc {
+		return func(endpoint *WeightedEndpointStatus) PolicyResult {
+			return PolicyResult{Status: name}
+		}
+	}
+	rules := []PolicyRule{
+		{Namespace: "kube-system", Service: "etcd", Policy: policyNamed("etcd")},
+		{Namespace: "kube-system", Service: PolicyWildcard, Policy: policyNamed("kube-system")},
+		{Namespace: PolicyWildcard, Service: "batch-api", Policy: policyNamed("batch-api")},
+		{Namespace: PolicyWildcard, Service: PolicyWildcard, Policy: policyNamed("default")},
+	}
+	scenarios := []struct {
+		name           string
+		rules          []PolicyRule
+		namespace      string
+		service        string
+		expectedPolicy string
+	}{
+		{name: "no rules", namespace: "kube-system", service: "etcd", expectedPolicy: "global"},
+		{name: "exact match", rules: rules, namespace: "kube-system", service: "etcd", expectedPolicy: "etcd"},
+		{name: "any service in a namespace", rules: rules, namespace: "kube-system", service: "apiserver", expectedPolicy: "kube-system"},
+		{name: "an exact namespace wins over an exact service", rules: rules, namespace: "kube-system", service: "batch-api", expectedPolicy: "kube-system"},
+		{name: "a service in any namespace", rules: rules, namespace: "jobs", service: "batch-api", expectedPolicy: "batch-api"},
+		{name: "default rule", rules: rules, namespace: "jobs", service: "web", expectedPolicy: "default"},
+		{name: "no matching rule", rules: rules[:1], namespace: "jobs", service: "web", expectedPolicy: "global"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := newFailureDetector(EndpointSampleToServiceKeyFunction, policyNamed("global"), NewDefaultFailureDetector().createStoreFn, NewBatchQueue[string, *EndpointSample]())
+			if err := target.SetPolicies(scenario.rules); err != nil {
+				t.Fatal(err)
+			}
+
+			result := target.policyFor(scenario.namespace, scenario.service)(newWeightedEndpoint(defaultWindowSize, nil))
+			if result.Status != scenario.expectedPolicy {
+				t.Fatalf("expected %q policy but got %q", scenario.expectedPolicy, result.Status)
+			}
+		})
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	target := NewDefaultFailureDetector()
+
+	// the default policy ejects an endpoint after 100 errors
+	if err := target.SetPolicy(PolicyRule{Namespace: "ns", Service: PolicyWildcard, Policy: NewSimplePolicy(SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 20})}); err != nil {
+		t.Fatal(err)
+	}
+	for _, endpointSample := range genSamples(endpoint, 20, true) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	if isHealthy, _ := target.EndpointStatus("ns", "etcd", endpoint); isHealthy {
+		t.Fatal("expected the endpoint to be ejected by the aggressive policy")
+	}
+
+	// removing the rule brings back the default policy, 20 successes restore 20 errors
+	if err := target.SetPolicy(PolicyRule{Namespace: "ns", Service: PolicyWildcard}); err != nil {
+		t.Fatal(err)
+	}
+	for _, endpointSample := range genSamples(endpoint, 20, false) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	if isHealthy, weight := target.EndpointStatus("ns", "etcd", endpoint); !isHealthy || weightToErrorCount(weight) != 80 {
+		t.Fatalf("expected the endpoint to be healthy with 0.2 weight, got %v, %v", isHealthy, weight)
+	}
+}
+
+func TestSetPolicyRejectsUnsupportedPolicies(t *testing.T) {
+	simple := NewSimplePolicy(SimplePolicyConfig{})
+	timeWindow := WithTimeWindow(time.Minute, time.Second)
+	scenarios := []struct {
+		name             string
+		options          []Option
+		rule             PolicyRule
+		expectedRejected bool
+	}{
+		{name: "EWMA policy", rule: NewEWMAPolicyRule("ns", "etcd", DefaultEWMAPolicyConfig)},
+		{name: "EWMA policy with a time window", options: []Option{timeWindow}, rule: NewEWMAPolicyRule("ns", "etcd", DefaultEWMAPolicyConfig), expectedRejected: true},
+		{
+			name:             "combined EWMA policy with a time window",
+			options:          []Option{timeWindow},
+			rule:             PolicyRule{Namespace: "ns", Service: "etcd", Policy: AnyOf(simple, NewEWMAPolicy(DefaultEWMAPolicyConfig)), RequiresSamples: true},
+			expectedRejected: true,
+		},
+		{name: "simple policy with a time window", options: []Option{timeWindow}, rule: PolicyRule{Namespace: "ns", Service: "etcd", Policy: simple}},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewDefaultFailureDetector(scenario.options...)
+			err := target.SetPolicy(scenario.rule)
+			if rejected := err != nil; rejected != scenario.expectedRejected {
+				t.Fatalf("expected the rule to be rejected: %v, got %v", scenario.expectedRejected, err)
+			}
+			if set := target.policies.get("ns", "etcd") != nil; set == scenario.expectedRejected {
+				t.Fatalf("expected the rule to be set: %v, got %v", !scenario.expectedRejected, set)
+			}
+
+			// none of the rules is applied when any of them is rejected
+			target = NewDefaultFailureDetector(scenario.options...)
+			err = target.SetPolicies([]PolicyRule{{Namespace: "ns", Service: "apiserver", Policy: simple}, scenario.rule})
+			if rejected := err != nil; rejected != scenario.expectedRejected {
+				t.Fatalf("expected the rules to be rejected: %v, got %v", scenario.expectedRejected, err)
+			}
+			if set := target.policies.get("ns", "apiserver") != nil; set == scenario.expectedRejected {
+				t.Fatalf("expected the rules to be set: %v, got %v", !scenario.expectedRejected, set)
+			}
+
+			// the rules are validated once all options have been applied
+			target = NewDefaultFailureDetector(append([]Option{WithPolicies([]PolicyRule{scenario.rule})}, scenario.options...)...)
+			if set := target.policies.get("ns", "etcd") != nil; set == scenario.expectedRejected {
+				t.Fatalf("expected the rule passed as an option to be kept: %v, got %v", !scenario.expectedRejected, set)
+			}
+		})
+	}
+}
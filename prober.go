@@ -0,0 +1,241 @@
+package failure_detector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ProbeFunc actively checks the given endpoint, it returns an error when the endpoint is considered unhealthy.
+// The given context is cancelled once the configured timeout expires
+type ProbeFunc func(ctx context.Context, endpoint *url.URL) error
+
+// ProbeConfig describes how endpoints of a Service are actively probed
+type ProbeConfig struct {
+	// Probe checks a single endpoint, HTTPGetProbe is used when not set
+	Probe ProbeFunc
+
+	// Interval is the period between two consecutive probes of an endpoint
+	Interval time.Duration
+
+	// Timeout bounds a single probe
+	Timeout time.Duration
+
+	// JitterFactor spreads probes over time, the actual period is in the [Interval, Interval*(1+JitterFactor)] range
+	JitterFactor float64
+}
+
+const (
+	defaultProbeInterval     = 10 * time.Second
+	defaultProbeTimeout      = 1 * time.Second
+	defaultProbeJitterFactor = 0.1
+)
+
+// withDefaults returns a copy of the config with fields that aren't set taken from the given defaults
+func (c ProbeConfig) withDefaults(defaults ProbeConfig) ProbeConfig {
+	if c.Probe == nil {
+		c.Probe = defaults.Probe
+	}
+	if c.Probe == nil {
+		c.Probe = HTTPGetProbe(nil)
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaults.Interval
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultProbeInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultProbeTimeout
+	}
+	if c.JitterFactor <= 0 {
+		c.JitterFactor = defaults.JitterFactor
+	}
+	if c.JitterFactor <= 0 {
+		c.JitterFactor = defaultProbeJitterFactor
+	}
+	return c
+}
+
+// HTTPGetProbe returns a ProbeFunc that issues a GET request against the endpoint's URL
+// it considers any status code in the [200, 400) range a success
+// a default client is used when the given client is nil
+func HTTPGetProbe(client *http.Client) ProbeFunc {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return func(ctx context.Context, endpoint *url.URL) error {
+		req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// drain the body so that the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// TCPConnectProbe is a ProbeFunc that opens (and immediately closes) a TCP connection to the endpoint's host
+// when the URL doesn't specify a port the default port for the scheme is used
+func TCPConnectProbe(ctx context.Context, endpoint *url.URL) error {
+	host := endpoint.Host
+	if len(endpoint.Port()) == 0 {
+		port := "80"
+		if endpoint.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(endpoint.Hostname(), port)
+	}
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// prober periodically probes registered endpoints and records the results as active EndpointSamples
+type prober struct {
+	// recordFn hands the probe results over to the detector
+	recordFn func(endpointSample *EndpointSample) bool
+
+	// clock schedules the probes
+	clock clock.Clock
+
+	// lock protects the fields below
+	lock sync.Mutex
+
+	// ctx is set only while the prober is running
+	ctx context.Context
+
+	// targets holds the endpoints to probe per Service (Namespace/Service)
+	targets map[string]*probeTarget
+
+	// defaults holds the values used for fields that aren't set in ProbeConfig
+	defaults ProbeConfig
+}
+
+// probeTarget describes the endpoints of a single Service that are probed by a dedicated worker
+type probeTarget struct {
+	namespace string
+	service   string
+	endpoints []*url.URL
+	config    ProbeConfig
+
+	// requested holds the config passed to set, config is derived from it and the defaults
+	requested ProbeConfig
+
+	// cancel stops the worker, it is nil when the worker hasn't been started
+	cancel context.CancelFunc
+}
+
+func newProber(recordFn func(endpointSample *EndpointSample) bool) *prober {
+	return &prober{recordFn: recordFn, clock: clock.RealClock{}, targets: map[string]*probeTarget{}}
+}
+
+// set replaces the endpoints probed for the given Service, an empty list stops probing the Service
+func (p *prober) set(namespace, service string, config ProbeConfig, endpoints []*url.URL) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := EndpointSampleToServiceKeyFunction(&EndpointSample{Namespace: namespace, Service: service})
+	if current := p.targets[key]; current != nil && current.cancel != nil {
+		current.cancel()
+	}
+	delete(p.targets, key)
+	if len(endpoints) == 0 {
+		return
+	}
+
+	target := &probeTarget{namespace: namespace, service: service, endpoints: endpoints, config: config.withDefaults(p.defaults), requested: config}
+	p.targets[key] = target
+	if p.ctx != nil {
+		p.startWorkerLocked(target)
+	}
+}
+
+// setDefaults sets the values used for fields that aren't set in ProbeConfig,
+// Services registered before the call pick up the new values and running workers are restarted
+func (p *prober) setDefaults(defaults ProbeConfig) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.defaults = defaults
+
+	for key, current := range p.targets {
+		target := &probeTarget{namespace: current.namespace, service: current.service, endpoints: current.endpoints, config: current.requested.withDefaults(defaults), requested: current.requested}
+		p.targets[key] = target
+		if current.cancel != nil {
+			current.cancel()
+			p.startWorkerLocked(target)
+		}
+	}
+}
+
+// run starts a worker for every registered Service and blocks until the given context is done
+func (p *prober) run(ctx context.Context) {
+	p.lock.Lock()
+	p.ctx = ctx
+	for _, target := range p.targets {
+		p.startWorkerLocked(target)
+	}
+	p.lock.Unlock()
+
+	<-ctx.Done()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ctx = nil
+	for _, target := range p.targets {
+		target.cancel = nil
+	}
+}
+
+func (p *prober) startWorkerLocked(target *probeTarget) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	target.cancel = cancel
+	backoff := wait.NewJitteredBackoffManager(target.config.Interval, target.config.JitterFactor, p.clock)
+	go wait.BackoffUntil(func() { p.probe(ctx, target) }, backoff, true, ctx.Done())
+}
+
+// probe concurrently checks all endpoints of the given target and records the results
+func (p *prober) probe(ctx context.Context, target *probeTarget) {
+	defer utilruntime.HandleCrash()
+
+	wg := sync.WaitGroup{}
+	for _, endpoint := range target.endpoints {
+		wg.Add(1)
+		go func(endpoint *url.URL) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, target.config.Timeout)
+			defer cancel()
+
+			err := target.config.Probe(probeCtx, endpoint)
+			if ctx.Err() != nil {
+				// the target has been removed or the prober is shutting down
+				return
+			}
+			p.recordFn(&EndpointSample{Namespace: target.namespace, Service: target.service, URL: endpoint, Err: err, Active: true})
+		}(endpoint)
+	}
+	wg.Wait()
+}
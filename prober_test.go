@@ -0,0 +1,141 @@
+package failure_detector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestProber(t *testing.T) {
+	healthyEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	unhealthyEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	probe := func(ctx context.Context, endpoint *url.URL) error {
+		if endpoint.Host == unhealthyEndpoint.Host {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+
+	samplesCh := make(chan *EndpointSample, 100)
+	target := newProber(func(endpointSample *EndpointSample) bool {
+		samplesCh <- endpointSample
+		return true
+	})
+	fakeClock := clock.NewFakeClock(time.Now())
+	target.clock = fakeClock
+	target.set("ns", "etcd", ProbeConfig{Probe: probe, Interval: time.Second}, []*url.URL{healthyEndpoint, unhealthyEndpoint})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go target.run(ctx)
+
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case endpointSample := <-samplesCh:
+			if !endpointSample.Active {
+				t.Fatalf("expected an active sample, got %#v", endpointSample)
+			}
+			if endpointSample.Namespace != "ns" || endpointSample.Service != "etcd" {
+				t.Fatalf("unexpected Service %s/%s", endpointSample.Namespace, endpointSample.Service)
+			}
+			if expectErr := endpointSample.URL.Host == unhealthyEndpoint.Host; expectErr != (endpointSample.Err != nil) {
+				t.Fatalf("unexpected error %v for %s", endpointSample.Err, endpointSample.URL.Host)
+			}
+			seen[endpointSample.URL.Host] = true
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out waiting for probe results, got results for %v", seen)
+		}
+	}
+
+	// the worker waits for the next round once the first one has been recorded
+	waitForWaiters := func(expected bool) {
+		t.Helper()
+		if err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) { return fakeClock.HasWaiters() == expected, nil }); err != nil {
+			t.Fatalf("timed out waiting for the worker, expected waiters = %v", expected)
+		}
+	}
+	waitForWaiters(true)
+	if len(samplesCh) != 0 {
+		t.Fatalf("expected a single round of probes, got %d more results", len(samplesCh))
+	}
+
+	// the next round starts after the interval
+	fakeClock.Step(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-samplesCh:
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatal("timed out waiting for the second round of probes")
+		}
+	}
+
+	// the worker stops its timer once the targets have been removed, no more rounds are started afterwards
+	waitForWaiters(true)
+	target.set("ns", "etcd", ProbeConfig{}, nil)
+	waitForWaiters(false)
+	fakeClock.Step(2 * time.Second)
+	if len(samplesCh) != 0 {
+		t.Fatalf("expected no more probe results after removing the targets, got %d", len(samplesCh))
+	}
+}
+
+func TestHTTPGetProbe(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		statusCode  int
+		expectError bool
+	}{
+		{name: "200 is a success", statusCode: http.StatusOK},
+		{name: "302 is a success", statusCode: http.StatusFound},
+		{name: "404 is a failure", statusCode: http.StatusNotFound, expectError: true},
+		{name: "503 is a failure", statusCode: http.StatusServiceUnavailable, expectError: true},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					t.Errorf("expected GET, got %s", r.Method)
+				}
+				w.WriteHeader(scenario.statusCode)
+			}))
+			defer server.Close()
+
+			endpoint, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+			err = HTTPGetProbe(client)(context.TODO(), endpoint)
+			if scenario.expectError != (err != nil) {
+				t.Fatalf("expected error = %v, got %v", scenario.expectError, err)
+			}
+		})
+	}
+}
+
+func TestTCPConnectProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	if err := TCPConnectProbe(context.TODO(), &url.URL{Scheme: "https", Host: address}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	listener.Close()
+	if err := TCPConnectProbe(context.TODO(), &url.URL{Scheme: "https", Host: address}); err == nil {
+		t.Fatal("expected an error for a closed listener")
+	}
+}
@@ -0,0 +1,182 @@
+package failure_detector
+
+import "net/url"
+
+// EndpointHealth describes the health of an endpoint as seen by the detector
+type EndpointHealth string
+
+const (
+	// EndpointHealthy means the collected samples don't indicate a problem with the endpoint
+	EndpointHealthy EndpointHealth = "Healthy"
+
+	// EndpointUnhealthy means the policy has rejected the endpoint
+	EndpointUnhealthy EndpointHealth = "Unhealthy"
+
+	// EndpointUnknown means the detector has no opinion about the endpoint,
+	// either because it hasn't collected any data for it or because the endpoint doesn't belong to the Service
+	EndpointUnknown EndpointHealth = "Unknown"
+)
+
+// RegisteredEndpoint describes an endpoint of a Service along with the conditions reported by an external source (i.e. Kubernetes)
+type RegisteredEndpoint struct {
+	URL *url.URL
+
+	// EndpointID identifies the endpoint when the detector has been configured with EndpointIDKey
+	EndpointID string
+
+	// Ready indicates the endpoint is ready to serve traffic, not ready endpoints are considered unhealthy
+	Ready bool
+
+	// Terminating indicates the endpoint is shutting down, terminating endpoints are considered unhealthy
+	Terminating bool
+}
+
+const (
+	// EndpointStatusReasonNotReady means the endpoint has been registered as not ready
+	EndpointStatusReasonNotReady = "NotReady"
+
+	// EndpointStatusReasonTerminating means the endpoint has been registered as terminating
+	EndpointStatusReasonTerminating = "Terminating"
+)
+
+// conditionsReason returns the reason the registered conditions make the endpoint unhealthy or an empty string
+func (e *RegisteredEndpoint) conditionsReason() string {
+	if e.Terminating {
+		return EndpointStatusReasonTerminating
+	}
+	if !e.Ready {
+		return EndpointStatusReasonNotReady
+	}
+	return ""
+}
+
+// endpointRegistry holds the endpoints registered per Service (endpoint key -> RegisteredEndpoint), the read path doesn't take a lock
+type endpointRegistry struct {
+	endpoints *serviceMap[map[string]*RegisteredEndpoint]
+}
+
+func newEndpointRegistry() *endpointRegistry {
+	return &endpointRegistry{endpoints: newServiceMap[map[string]*RegisteredEndpoint]()}
+}
+
+// set replaces the endpoints of the given Service and returns the keys of the endpoints that have been removed
+func (r *endpointRegistry) set(namespace, service string, endpoints []RegisteredEndpoint, endpointKeyFn EndpointKeyFunc) []string {
+	newEndpoints := make(map[string]*RegisteredEndpoint, len(endpoints))
+	for i := range endpoints {
+		endpoint := endpoints[i]
+		endpointKey := endpointKeyFn(endpoint.URL, endpoint.EndpointID)
+		if len(endpointKey) == 0 {
+			// the endpoint can't be identified (e.g. a missing EndpointID), it would be confused with other such endpoints
+			continue
+		}
+		newEndpoints[endpointKey] = &endpoint
+	}
+
+	removed := []string{}
+	r.endpoints.update(namespace, service, func(current map[string]*RegisteredEndpoint, _ bool) (map[string]*RegisteredEndpoint, bool) {
+		for endpointKey := range current {
+			if _, ok := newEndpoints[endpointKey]; !ok {
+				removed = append(removed, endpointKey)
+			}
+		}
+		return newEndpoints, true
+	})
+	return removed
+}
+
+// remove deregisters the given Service
+func (r *endpointRegistry) remove(namespace, service string) {
+	r.endpoints.delete(namespace, service)
+}
+
+// get returns the given endpoint if it belongs to the given Service.
+// The second value is false if no endpoints have been registered for the Service at all
+func (r *endpointRegistry) get(namespace, service, endpointKey string) (endpoint *RegisteredEndpoint, hasService bool) {
+	endpoints, hasService := r.endpoints.get(namespace, service)
+	if !hasService {
+		return nil, false
+	}
+	return endpoints[endpointKey], true
+}
+
+// isRegistered returns true if the given endpoint belongs to the given Service.
+// The second value is false if no endpoints have been registered for the Service at all
+func (r *endpointRegistry) isRegistered(namespace, service, endpointKey string) (registered bool, hasService bool) {
+	endpoint, hasService := r.get(namespace, service, endpointKey)
+	return endpoint != nil, hasService
+}
+
+// SetEndpoints registers the given endpoints as the only endpoints of the given Service.
+// Data collected for endpoints that are no longer registered is pruned right away and samples
+// for endpoints that don't belong to the Service are ignored from now on.
+// Services without registered endpoints accept samples for any endpoint.
+// Detectors that identify endpoints by EndpointSample.EndpointID must use SetEndpointsWithIDs instead.
+// It is safe to call while the detector is running
+func (fd *failureDetector) SetEndpoints(namespace, service string, urls []*url.URL) {
+	endpoints := make([]RegisteredEndpoint, len(urls))
+	for i, u := range urls {
+		endpoints[i] = RegisteredEndpoint{URL: u, Ready: true}
+	}
+	fd.SetEndpointsWithConditions(namespace, service, endpoints)
+}
+
+// SetEndpointsWithIDs works like SetEndpoints for detectors that identify endpoints by EndpointSample.EndpointID (see EndpointIDKey),
+// the given map holds the URLs of the endpoints under their IDs
+func (fd *failureDetector) SetEndpointsWithIDs(namespace, service string, urls map[string]*url.URL) {
+	endpoints := make([]RegisteredEndpoint, 0, len(urls))
+	for endpointID, u := range urls {
+		endpoints = append(endpoints, RegisteredEndpoint{URL: u, EndpointID: endpointID, Ready: true})
+	}
+	fd.SetEndpointsWithConditions(namespace, service, endpoints)
+}
+
+// SetEndpointsWithConditions works like SetEndpoints but additionally takes into account conditions reported by an external source,
+// endpoints that are not ready or terminating are reported as unhealthy no matter what the collected samples say
+func (fd *failureDetector) SetEndpointsWithConditions(namespace, service string, endpoints []RegisteredEndpoint) {
+	removedEndpointKeys := fd.registry.set(namespace, service, endpoints, fd.endpointKeyFn)
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	name := serviceName{namespace: namespace, service: service}
+	endpointsStore, ok := fd.store.Get(name)
+	if !ok || len(removedEndpointKeys) == 0 {
+		return
+	}
+
+	trackedEndpoints := endpointsStore.Len()
+	for _, endpointKey := range removedEndpointKeys {
+		endpointsStore.Delete(endpointKey)
+	}
+	fd.trackedEndpoints -= trackedEndpoints - endpointsStore.Len()
+	if endpointsStore.Len() == 0 {
+		fd.store.Delete(name)
+	}
+	fd.propagateChangesToReadOnlyStore(name)
+}
+
+// RemoveService deregisters the given Service and drops all data collected for it.
+// It is safe to call while the detector is running
+func (fd *failureDetector) RemoveService(namespace, service string) {
+	fd.registry.remove(namespace, service)
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	name := serviceName{namespace: namespace, service: service}
+	endpointsStore, ok := fd.store.Get(name)
+	if !ok {
+		return
+	}
+	fd.trackedEndpoints -= endpointsStore.Len()
+	fd.store.Delete(name)
+	fd.propagateChangesToReadOnlyStore(name)
+}
+
+// EndpointHealth returns the current health and weight of the given endpoint for the given Service.
+// Unlike EndpointStatus it doesn't consider endpoints without data healthy, instead it returns EndpointUnknown
+// which is also returned for endpoints that haven't been registered for the Service via SetEndpoints.
+// Detectors that identify endpoints by EndpointSample.EndpointID should use ServiceView.EndpointHealthWithID
+func (fd *failureDetector) EndpointHealth(namespace, service string, url *url.URL) (health EndpointHealth, weight float32) {
+	return fd.Lookup(namespace, service).EndpointHealth(url)
+}
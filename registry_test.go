@@ -0,0 +1,216 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestEndpointHealth(t *testing.T) {
+	endpointA := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	endpointB := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	endpointC := &url.URL{Scheme: "https", Host: "1.1.1.3:6443"}
+
+	scenarios := []struct {
+		name           string
+		registered     []*url.URL
+		samples        []*EndpointSample
+		reRegistered   []*url.URL
+		endpoint       *url.URL
+		expectedHealth EndpointHealth
+		expectedWeight float32
+	}{
+		{
+			name:           "no data - unknown",
+			endpoint:       endpointA,
+			expectedHealth: EndpointUnknown,
+			expectedWeight: 1,
+		},
+		{
+			name:           "registered without data - unknown",
+			registered:     []*url.URL{endpointA},
+			endpoint:       endpointA,
+			expectedHealth: EndpointUnknown,
+			expectedWeight: 1,
+		},
+		{
+			name:           "not registered endpoint of a registered Service - unknown",
+			registered:     []*url.URL{endpointA},
+			samples:        genSamples(endpointA, 10, true),
+			endpoint:       endpointB,
+			expectedHealth: EndpointUnknown,
+			expectedWeight: 1,
+		},
+		{
+			name:           "samples of unregistered endpoints are ignored",
+			registered:     []*url.URL{endpointA},
+			samples:        genSamples(endpointB, 100, true),
+			endpoint:       endpointB,
+			expectedHealth: EndpointUnknown,
+			expectedWeight: 1,
+		},
+		{
+			name:           "registered endpoint with errors - healthy with a decreased weight",
+			registered:     []*url.URL{endpointA},
+			samples:        genSamples(endpointA, 10, true),
+			endpoint:       endpointA,
+			expectedHealth: EndpointHealthy,
+			expectedWeight: 0.9,
+		},
+		{
+			name:           "registered endpoint with too many errors - unhealthy",
+			registered:     []*url.URL{endpointA},
+			samples:        genSamples(endpointA, 100, true),
+			endpoint:       endpointA,
+			expectedHealth: EndpointUnhealthy,
+			expectedWeight: 0,
+		},
+		{
+			name:           "unregistered Service with too many errors - unhealthy",
+			samples:        genSamples(endpointA, 100, true),
+			endpoint:       endpointA,
+			expectedHealth: EndpointUnhealthy,
+			expectedWeight: 0,
+		},
+		{
+			name:           "removed endpoint is pruned right away",
+			registered:     []*url.URL{endpointA, endpointB},
+			samples:        genSamples(endpointA, 100, true),
+			reRegistered:   []*url.URL{endpointB, endpointC},
+			endpoint:       endpointA,
+			expectedHealth: EndpointUnknown,
+			expectedWeight: 1,
+		},
+		{
+			name:           "endpoints that stay registered are kept",
+			registered:     []*url.URL{endpointA, endpointB},
+			samples:        append(genSamples(endpointA, 100, true), genSamples(endpointB, 10, true)...),
+			reRegistered:   []*url.URL{endpointB},
+			endpoint:       endpointB,
+			expectedHealth: EndpointHealthy,
+			expectedWeight: 0.9,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewDefaultFailureDetector()
+			if scenario.registered != nil {
+				target.SetEndpoints("ns", "etcd", scenario.registered)
+			}
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+			if scenario.reRegistered != nil {
+				target.SetEndpoints("ns", "etcd", scenario.reRegistered)
+
+				// the pruned data must not be used by the old API either
+				if isHealthy, weight := target.EndpointStatus("ns", "etcd", endpointA); !isHealthy || weight != 1 {
+					t.Fatalf("expected the pruned endpoint to be reported as healthy with the default weight, got %v, %v", isHealthy, weight)
+				}
+			}
+
+			health, weight := target.EndpointHealth("ns", "etcd", scenario.endpoint)
+			if health != scenario.expectedHealth {
+				t.Fatalf("expected %s health but got %s", scenario.expectedHealth, health)
+			}
+			if weightToErrorCount(weight) != weightToErrorCount(scenario.expectedWeight) {
+				t.Fatalf("expected %v weight but got %v", scenario.expectedWeight, weight)
+			}
+		})
+	}
+}
+
+func genSamples(endpoint *url.URL, number int, withErr bool) []*EndpointSample {
+	ret := make([]*EndpointSample, number)
+	for i := 0; i < number; i++ {
+		var err error
+		if withErr {
+			err = fmt.Errorf("error %d", i)
+		}
+		ret[i] = &EndpointSample{Namespace: "ns", Service: "etcd", URL: endpoint, Err: err}
+	}
+	return ret
+}
+
+func TestEndpointHealthWithConditions(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+
+	scenarios := []struct {
+		name              string
+		registered        RegisteredEndpoint
+		samples           []*EndpointSample
+		expectedHealth    EndpointHealth
+		expectedWeight    float32
+		expectedIsHealthy bool
+	}{
+		{
+			name:              "ready endpoint with errors - healthy with a decreased weight",
+			registered:        RegisteredEndpoint{URL: endpoint, Ready: true},
+			samples:           genSamples(endpoint, 10, true),
+			expectedHealth:    EndpointHealthy,
+			expectedWeight:    0.9,
+			expectedIsHealthy: true,
+		},
+		{
+			name:           "not ready endpoint without errors - unhealthy",
+			registered:     RegisteredEndpoint{URL: endpoint},
+			samples:        genSamples(endpoint, 10, false),
+			expectedHealth: EndpointUnhealthy,
+			expectedWeight: 0,
+		},
+		{
+			name:           "terminating endpoint without data - unhealthy",
+			registered:     RegisteredEndpoint{URL: endpoint, Ready: true, Terminating: true},
+			expectedHealth: EndpointUnhealthy,
+			expectedWeight: 0,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := NewDefaultFailureDetector()
+			target.SetEndpointsWithConditions("ns", "etcd", []RegisteredEndpoint{scenario.registered})
+			for _, endpointSample := range scenario.samples {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			health, weight := target.EndpointHealth("ns", "etcd", endpoint)
+			if health != scenario.expectedHealth {
+				t.Fatalf("expected %s health but got %s", scenario.expectedHealth, health)
+			}
+			if weightToErrorCount(weight) != weightToErrorCount(scenario.expectedWeight) {
+				t.Fatalf("expected %v weight but got %v", scenario.expectedWeight, weight)
+			}
+			if isHealthy, _ := target.EndpointStatus("ns", "etcd", endpoint); isHealthy != scenario.expectedIsHealthy {
+				t.Fatalf("expected EndpointStatus to report isHealthy = %v", scenario.expectedIsHealthy)
+			}
+		})
+	}
+}
+
+func TestRemoveService(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	otherEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.2:6443"}
+	target := NewDefaultFailureDetector()
+	target.SetEndpoints("ns", "etcd", []*url.URL{endpoint})
+	for _, endpointSample := range genSamples(endpoint, 100, true) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	if health, _ := target.EndpointHealth("ns", "etcd", endpoint); health != EndpointUnhealthy {
+		t.Fatalf("expected %s health but got %s", EndpointUnhealthy, health)
+	}
+
+	target.RemoveService("ns", "etcd")
+	if health, _ := target.EndpointHealth("ns", "etcd", endpoint); health != EndpointUnknown {
+		t.Fatalf("expected %s health after removing the Service but got %s", EndpointUnknown, health)
+	}
+
+	// the Service is no longer registered, samples for any endpoint are accepted again
+	for _, endpointSample := range genSamples(otherEndpoint, 10, true) {
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	if health, _ := target.EndpointHealth("ns", "etcd", otherEndpoint); health != EndpointHealthy {
+		t.Fatalf("expected %s health but got %s", EndpointHealthy, health)
+	}
+}
@@ -0,0 +1,83 @@
+package failure_detector
+
+import (
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// ReplayEvent describes a change of the status or the weight of an endpoint observed while replaying a trace
+type ReplayEvent struct {
+	Timestamp time.Time
+	Namespace string
+	Service   string
+	Endpoint  string
+	Status    string
+	Weight    float32
+}
+
+// Replay feeds samples from the given trace through a detector that uses the given policy and a simulated clock driven by the timestamps of the trace.
+// The given function is called for every change of the status or the weight of an endpoint.
+// Samples are processed one at a time, in the order in which they have been recorded,
+// which approximates the batching done by a running detector
+func Replay(trace io.Reader, policy EvaluateFunc, eventFn func(event ReplayEvent)) error {
+	simulatedClock := clock.NewFakeClock(time.Time{})
+	createStoreFn := func(ttl time.Duration) *WeightedEndpointStatusStore {
+		return NewStore[string, *WeightedEndpointStatus](ttl, simulatedClock)
+	}
+	fd := newFailureDetector(EndpointSampleToServiceKeyFunction, policy, createStoreFn, NewBatchQueue[string, *EndpointSample]())
+	fd.clock = simulatedClock
+
+	type state struct {
+		status string
+		weight float32
+	}
+	lastStates := map[string]state{}
+
+	reader := NewTraceReader(trace)
+	for {
+		record, endpointSample, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if record.Timestamp.After(simulatedClock.Now()) {
+			simulatedClock.SetTime(record.Timestamp)
+		}
+		// samples might have been recorded out of order, they keep their own time
+		endpointSample.Timestamp = record.Timestamp
+		fd.processBatch([]*EndpointSample{endpointSample})
+
+		endpointsStore, ok := fd.store.Get(serviceName{namespace: endpointSample.Namespace, service: endpointSample.Service})
+		if !ok {
+			continue
+		}
+		endpointKey, _ := fd.convertToKeySample(endpointSample)
+		endpoint, ok := endpointsStore.Get(endpointKey)
+		if !ok {
+			continue
+		}
+
+		stateKey := fd.endpointSampleKeyFn(endpointSample) + "/" + endpointKey
+		lastState, seen := lastStates[stateKey]
+		if !seen {
+			lastState = state{weight: 1}
+		}
+		if lastState.status == endpoint.status && lastState.weight == endpoint.weight {
+			continue
+		}
+		lastStates[stateKey] = state{status: endpoint.status, weight: endpoint.weight}
+		eventFn(ReplayEvent{
+			Timestamp: record.Timestamp,
+			Namespace: endpointSample.Namespace,
+			Service:   endpointSample.Service,
+			Endpoint:  endpointKey,
+			Status:    endpoint.status,
+			Weight:    endpoint.weight,
+		})
+	}
+}
@@ -140,12 +140,34 @@ func TestSimpleWeightedEndpointStatusEvaluator(t *testing.T) {
 				{data: errToSampleFunc(genNilErrors(10)...), expectedWeight: 0.10, expectedHasChanged: true},
 			},
 		},
+
+		{
+			name:               "thinned successes",
+			endpoint:           createWeightedEndpointStatus(errToSampleFunc(genErrors(10)...)),
+			expectedWeight:     0.90,
+			expectedHasChanged: true,
+			steps: []struct {
+				data               []*Sample
+				expectedStatus     string
+				expectedWeight     float32
+				expectedHasChanged bool
+			}{
+				// step 1
+				{data: errToSampleFunc(genErrors(10)...), expectedWeight: 0.80, expectedHasChanged: true},
+
+				// step 2 - a success sampled at the rate of 0.25 stands for 4 requests, 2 of them don't change the weight
+				{data: countedSamples(4, genNilErrors(2)...), expectedWeight: 0.80},
+
+				// step 3 - 5 of them stand for 20 requests that increase the weight by two steps
+				{data: countedSamples(4, genNilErrors(3)...), expectedWeight: 1.0, expectedHasChanged: true},
+			},
+		},
 	}
 
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
 			// test data
-			hasChanged := SimpleWeightedEndpointStatusEvaluator(scenario.endpoint)
+			hasChanged := scenario.endpoint.apply(SimpleWeightedEndpointStatusEvaluator(scenario.endpoint))
 
 			validate := func(actualHasChanged bool, expectedHasChanged bool, expectedStatus string, expectedWeight float32) {
 				if actualHasChanged != expectedHasChanged {
@@ -165,7 +187,7 @@ func TestSimpleWeightedEndpointStatusEvaluator(t *testing.T) {
 				for _, sample := range step.data {
 					scenario.endpoint.Add(sample)
 				}
-				hasChanged := SimpleWeightedEndpointStatusEvaluator(scenario.endpoint)
+				hasChanged := scenario.endpoint.apply(SimpleWeightedEndpointStatusEvaluator(scenario.endpoint))
 				validate(hasChanged, step.expectedHasChanged, step.expectedStatus, step.expectedWeight)
 			}
 		})
@@ -188,6 +210,14 @@ func errToSampleFunc(err ...error) []*Sample {
 	return ret
 }
 
+func countedSamples(count float64, err ...error) []*Sample {
+	ret := errToSampleFunc(err...)
+	for _, sample := range ret {
+		sample.count = count
+	}
+	return ret
+}
+
 func genErrors(number int) []error {
 	ret := make([]error, number)
 	for i := 0; i < number; i++ {
@@ -203,3 +233,30 @@ func genNilErrors(number int) []error {
 	}
 	return ret
 }
+
+func TestNewSimplePolicy(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		config         SimplePolicyConfig
+		errors         int
+		expectedStatus string
+		expectedWeight float32
+	}{
+		{name: "defaults", errors: 10, expectedWeight: 0.9},
+		{name: "lower threshold", config: SimplePolicyConfig{ErrorThreshold: 5}, errors: 5, expectedWeight: 0.95},
+		{name: "fewer errors eject", config: SimplePolicyConfig{ErrorThreshold: 5, MaxErrors: 10}, errors: 5, expectedWeight: 0.5},
+		{name: "ejection", config: SimplePolicyConfig{ErrorThreshold: 10, MaxErrors: 10}, errors: 10, expectedStatus: EndpointStatusReasonTooManyErrors},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			endpoint := createWeightedEndpointStatus(errToSampleFunc(genErrors(scenario.errors)...))
+			if !endpoint.apply(NewSimplePolicy(scenario.config)(endpoint)) {
+				t.Fatal("expected the endpoint to change")
+			}
+			if endpoint.status != scenario.expectedStatus || endpoint.weight != scenario.expectedWeight {
+				t.Fatalf("expected %q status and %v weight but got %q and %v", scenario.expectedStatus, scenario.expectedWeight, endpoint.status, endpoint.weight)
+			}
+		})
+	}
+}
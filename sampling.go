@@ -0,0 +1,74 @@
+package failure_detector
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// samplingRates holds per-Service sampling rates that are safe for concurrent access, the read path (Record) doesn't take a lock nor allocate
+type samplingRates struct {
+	rates *serviceMap[float64]
+
+	// defaultRate is used for Services that don't have a rate assigned, must be accessed atomically via the helper methods
+	defaultRate atomic.Value
+
+	// randFloat64 returns a pseudo-random number in [0, 1)
+	randFloat64 func() float64
+}
+
+func newSamplingRates() *samplingRates {
+	s := &samplingRates{rates: newServiceMap[float64](), randFloat64: rand.Float64}
+	s.defaultRate.Store(float64(1))
+	return s
+}
+
+// set assigns the given rate to the given Service, a rate of 1 (or more) disables thinning
+func (s *samplingRates) set(namespace, service string, rate float64) {
+	s.rates.set(namespace, service, normalizeSamplingRate(rate))
+}
+
+// setDefault assigns the given rate to all Services that don't have a rate assigned
+func (s *samplingRates) setDefault(rate float64) {
+	s.defaultRate.Store(normalizeSamplingRate(rate))
+}
+
+// get returns the sampling rate for the given Service
+func (s *samplingRates) get(namespace, service string) float64 {
+	if rate, ok := s.rates.get(namespace, service); ok {
+		return rate
+	}
+	return s.defaultRate.Load().(float64)
+}
+
+// keep decides whether the given EndpointSample should be processed, it doesn't modify the sample.
+// Samples that carry an error and active samples are always kept, successful samples are kept with the probability equal to the sampling rate of the Service.
+// For kept samples that have been thinned it also returns the rate so that they can be accounted as 1/rate requests by the policies, otherwise the rate is 0
+func (s *samplingRates) keep(endpointSample *EndpointSample) (bool, float64) {
+	if endpointSample == nil || endpointSample.Err != nil || endpointSample.Active {
+		return true, 0
+	}
+	rate := s.get(endpointSample.Namespace, endpointSample.Service)
+	if rate >= 1 {
+		return true, 0
+	}
+	if s.randFloat64() >= rate {
+		return false, 0
+	}
+	return true, rate
+}
+
+// normalizeSamplingRate clamps the given rate to the (0, 1] range, NaN disables thinning
+func normalizeSamplingRate(rate float64) float64 {
+	if math.IsNaN(rate) || rate > 1 {
+		return 1
+	}
+	if rate <= 0 {
+		// a rate of 0 would mean never seeing a successful sample which would eventually eject every endpoint
+		return minSamplingRate
+	}
+	return rate
+}
+
+// minSamplingRate is the smallest rate that can be assigned to a Service
+const minSamplingRate = 0.0001
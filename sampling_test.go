@@ -0,0 +1,123 @@
+package failure_detector
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"testing"
+)
+
+func TestSamplingRatesKeep(t *testing.T) {
+	scenarios := []struct {
+		name                 string
+		rate                 *float64
+		defaultRate          *float64
+		randValue            float64
+		sample               *EndpointSample
+		expectedKeep         bool
+		expectedSamplingRate float64
+	}{
+		{
+			name:         "no rate assigned - the sample is kept",
+			randValue:    0.99,
+			sample:       &EndpointSample{Namespace: "ns", Service: "svc"},
+			expectedKeep: true,
+		},
+		{
+			name:         "errors are always kept",
+			rate:         float64Ptr(0.1),
+			randValue:    0.99,
+			sample:       &EndpointSample{Namespace: "ns", Service: "svc", Err: fmt.Errorf("nasty error")},
+			expectedKeep: true,
+		},
+		{
+			name:                 "a success within the rate is kept along with the rate",
+			rate:                 float64Ptr(0.25),
+			randValue:            0.2,
+			sample:               &EndpointSample{Namespace: "ns", Service: "svc"},
+			expectedKeep:         true,
+			expectedSamplingRate: 0.25,
+		},
+		{
+			name:      "a success outside of the rate is thinned",
+			rate:      float64Ptr(0.25),
+			randValue: 0.3,
+			sample:    &EndpointSample{Namespace: "ns", Service: "svc"},
+		},
+		{
+			name:        "the default rate applies to Services without a rate",
+			defaultRate: float64Ptr(0.5),
+			randValue:   0.6,
+			sample:      &EndpointSample{Namespace: "ns", Service: "svc"},
+		},
+		{
+			name:         "a NaN rate disables thinning",
+			rate:         float64Ptr(math.NaN()),
+			randValue:    0.99,
+			sample:       &EndpointSample{Namespace: "ns", Service: "svc"},
+			expectedKeep: true,
+		},
+		{
+			name:         "a NaN default rate disables thinning",
+			defaultRate:  float64Ptr(math.NaN()),
+			randValue:    0.99,
+			sample:       &EndpointSample{Namespace: "ns", Service: "svc"},
+			expectedKeep: true,
+		},
+		{
+			name:         "the rate of the Service takes precedence over the default rate",
+			rate:         float64Ptr(1),
+			defaultRate:  float64Ptr(0.5),
+			randValue:    0.6,
+			sample:       &EndpointSample{Namespace: "ns", Service: "svc"},
+			expectedKeep: true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			target := newSamplingRates()
+			target.randFloat64 = func() float64 { return scenario.randValue }
+			if scenario.defaultRate != nil {
+				target.setDefault(*scenario.defaultRate)
+			}
+			if scenario.rate != nil {
+				target.set("ns", "svc", *scenario.rate)
+			}
+			target.set("ns", "other-svc", 0.01)
+
+			keep, samplingRate := target.keep(scenario.sample)
+			if keep != scenario.expectedKeep {
+				t.Fatalf("expected keep to return %v but got %v", scenario.expectedKeep, keep)
+			}
+			if samplingRate != scenario.expectedSamplingRate {
+				t.Fatalf("expected the sampling rate to be %v but got %v", scenario.expectedSamplingRate, samplingRate)
+			}
+			if scenario.sample.samplingRate != 0 {
+				t.Fatalf("expected the sample not to be modified, got the sampling rate of %v", scenario.sample.samplingRate)
+			}
+		})
+	}
+}
+
+func TestRecordDoesNotModifyThinnedSamples(t *testing.T) {
+	target := NewDefaultFailureDetector()
+	target.samplingRates.randFloat64 = func() float64 { return 0 }
+	target.SetSamplingRate("ns", "svc", 0.5)
+
+	endpointSample := &EndpointSample{Namespace: "ns", Service: "svc", URL: &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}}
+	if !target.Record(endpointSample) {
+		t.Fatal("expected the sample to be accepted")
+	}
+	recorded := <-target.processor.collectCh
+	if recorded == endpointSample || endpointSample.samplingRate != 0 {
+		t.Fatal("expected the rate to be carried by a copy of the sample")
+	}
+	if recorded.samplingRate != 0.5 {
+		t.Fatalf("expected the recorded sample to carry the rate of 0.5, got %v", recorded.samplingRate)
+	}
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
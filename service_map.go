@@ -0,0 +1,83 @@
+package failure_detector
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// serviceMap holds a value per Service that is safe for concurrent access.
+// Values are kept in a copy-on-write map (Namespace -> Service -> value) so that the read paths (i.e. Record and processBatch) don't take a lock nor allocate,
+// writers are serialized and copy only the outer map and the services of the namespace they modify
+type serviceMap[V any] struct {
+	// lock serializes writers
+	lock sync.Mutex
+
+	// values is never modified in place
+	values atomic.Pointer[map[string]map[string]V]
+}
+
+func newServiceMap[V any]() *serviceMap[V] {
+	m := &serviceMap[V]{}
+	m.values.Store(&map[string]map[string]V{})
+	return m
+}
+
+// load returns the current map, it must not be modified
+func (m *serviceMap[V]) load() map[string]map[string]V {
+	return *m.values.Load()
+}
+
+// get returns the value of the given Service, the second value is false if the Service doesn't have a value
+func (m *serviceMap[V]) get(namespace, service string) (V, bool) {
+	value, ok := m.load()[namespace][service]
+	return value, ok
+}
+
+// set assigns the given value to the given Service
+func (m *serviceMap[V]) set(namespace, service string, value V) {
+	m.update(namespace, service, func(V, bool) (V, bool) { return value, true })
+}
+
+// delete removes the value of the given Service
+func (m *serviceMap[V]) delete(namespace, service string) {
+	m.update(namespace, service, func(current V, _ bool) (V, bool) { return current, false })
+}
+
+// update replaces the value of the given Service with the one returned by updateFn, updateFn is called with the lock held
+// and gets the current value, if any. When updateFn returns false as the second value the Service is removed
+func (m *serviceMap[V]) update(namespace, service string, updateFn func(current V, ok bool) (V, bool)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current := m.load()
+	currentValue, ok := current[namespace][service]
+	value, keep := updateFn(currentValue, ok)
+
+	updated := make(map[string]map[string]V, len(current)+1)
+	for ns, services := range current {
+		updated[ns] = services
+	}
+	services := make(map[string]V, len(current[namespace])+1)
+	for svc, svcValue := range current[namespace] {
+		services[svc] = svcValue
+	}
+	if keep {
+		services[service] = value
+	} else {
+		delete(services, service)
+	}
+	if len(services) > 0 {
+		updated[namespace] = services
+	} else {
+		delete(updated, namespace)
+	}
+
+	m.values.Store(&updated)
+}
+
+// replace replaces all values with the given ones, the given map must not be modified afterwards
+func (m *serviceMap[V]) replace(values map[string]map[string]V) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values.Store(&values)
+}
@@ -0,0 +1,43 @@
+package failure_detector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServiceMap(t *testing.T) {
+	target := newServiceMap[int]()
+	if _, ok := target.get("ns", "etcd"); ok {
+		t.Fatal("expected an empty map not to have a value")
+	}
+
+	target.set("ns", "etcd", 1)
+	target.set("ns", "apiserver", 2)
+	target.set("other", "etcd", 3)
+	loaded := target.load()
+
+	target.update("ns", "etcd", func(current int, ok bool) (int, bool) {
+		if !ok || current != 1 {
+			t.Fatalf("expected the current value of 1 but got %d, %v", current, ok)
+		}
+		return current + 10, true
+	})
+	target.delete("other", "etcd")
+	target.delete("missing", "etcd")
+
+	if actual, expected := target.load(), map[string]map[string]int{"ns": {"etcd": 11, "apiserver": 2}}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+	// readers that loaded the map before the writes don't observe them
+	if expected := map[string]map[string]int{"ns": {"etcd": 1, "apiserver": 2}, "other": {"etcd": 3}}; !reflect.DeepEqual(loaded, expected) {
+		t.Fatalf("expected the previously loaded map to stay %v but got %v", expected, loaded)
+	}
+
+	target.replace(map[string]map[string]int{"kube-system": {"etcd": 4}})
+	if value, ok := target.get("kube-system", "etcd"); !ok || value != 4 {
+		t.Fatalf("expected the value of 4 but got %d, %v", value, ok)
+	}
+	if _, ok := target.get("ns", "etcd"); ok {
+		t.Fatal("expected the replaced values to be gone")
+	}
+}
@@ -1,7 +1,8 @@
 package failure_detector
 
-// SimpleWeightedEndpointStatusEvaluator an external policy evaluator that sets the status and weight of the given endpoint based on the collected samples.
-// It returns true only if status or wight have changed otherwise false
+import "math"
+
+// SimpleWeightedEndpointStatusEvaluator an external policy evaluator that decides the status and weight of the given endpoint based on the collected samples.
 //
 // WeightedEndpointStatus.Status:
 // will be set to EndpointStatusReasonTooManyErrors only when it sees 10 errors
@@ -12,60 +13,102 @@ package failure_detector
 //  - the value of 1 means no errors
 //  - the value of 0 means it observed 100 errors
 //  - the value of 0.7 means it observed 30 errors
-func SimpleWeightedEndpointStatusEvaluator(endpoint *WeightedEndpointStatus) bool {
-	errThreshold := 10
-	errCount := 0
-
-	for _, sample := range endpoint.data {
-		if sample != nil && sample.err != nil {
-			errCount++
-		}
-		if sample != nil && sample.err == nil {
-			errCount--
-		}
-	}
+//
+// Samples that survived thinning (see SetSamplingRate) are accounted as 1/rate requests,
+// in that case the weight might change by more than one step at once
+func SimpleWeightedEndpointStatusEvaluator(endpoint *WeightedEndpointStatus) PolicyResult {
+	return defaultSimplePolicy(endpoint)
+}
 
-	abs := func(x int) int {
-		if x < 0 {
-			return x * -1
-		}
-		return x
-	}
+// SimplePolicyConfig parameterizes the policy returned by NewSimplePolicy
+type SimplePolicyConfig struct {
+	// ErrorThreshold the number of errors (in excess of successes) in the window of recent samples that moves the weight by one step,
+	// note that the window holds 10 samples thus higher values require thinned samples (see SetSamplingRate)
+	ErrorThreshold int `json:"errorThreshold,omitempty"`
 
-	if abs(errCount) != errThreshold {
-		return false
+	// MaxErrors the number of errors at which the weight drops to 0 and the endpoint is ejected (EndpointStatusReasonTooManyErrors),
+	// every error decreases the weight by 1/MaxErrors
+	MaxErrors int `json:"maxErrors,omitempty"`
+}
+
+// SimplePolicyReasonErrorCountChanged means the simple policy changed the weight of a healthy endpoint
+const SimplePolicyReasonErrorCountChanged = "ErrorCountChanged"
+
+// DefaultSimplePolicyConfig is used by SimpleWeightedEndpointStatusEvaluator
+var DefaultSimplePolicyConfig = SimplePolicyConfig{ErrorThreshold: 10, MaxErrors: 100}
+
+var defaultSimplePolicy = NewSimplePolicy(DefaultSimplePolicyConfig)
+
+// NewSimplePolicy returns a policy that works like SimpleWeightedEndpointStatusEvaluator but with the given parameters,
+// non-positive parameters are replaced with the defaults (DefaultSimplePolicyConfig)
+func NewSimplePolicy(config SimplePolicyConfig) EvaluateFunc {
+	if config.ErrorThreshold <= 0 {
+		config.ErrorThreshold = DefaultSimplePolicyConfig.ErrorThreshold
+	}
+	if config.MaxErrors <= 0 {
+		config.MaxErrors = DefaultSimplePolicyConfig.MaxErrors
 	}
+	return func(endpoint *WeightedEndpointStatus) PolicyResult {
+		return evaluateSimplePolicy(endpoint, config.ErrorThreshold, config.MaxErrors)
+	}
+}
+
+func evaluateSimplePolicy(endpoint *WeightedEndpointStatus, errThreshold, maxErrCount int) PolicyResult {
+	// samples that survived thinning stand for more than one request
+	_, requests, errors := endpoint.sampleCounts()
+	errCount := errors - (requests - errors)
 
-	prevErrCount := weightToErrorCount(endpoint.weight)
-	totalErrCount := prevErrCount + errCount
-	if totalErrCount < 0 || totalErrCount > errThreshold*10 {
-		return false
+	// the weight decided by this policy is kept in the state as the weight of the endpoint might have been decided by other policies (see AnyOf),
+	// endpoints without the state start from their current weight
+	state, ok := endpoint.policyState.(simplePolicyState)
+	if !ok {
+		state.weight = endpoint.weight
+	}
+	result := endpoint.current()
+	result.State = state
+	if math.Abs(errCount) < float64(errThreshold) {
+		return result
 	}
 
-	hasChanged := false
-	newWeight := 1 - 0.01*float32(totalErrCount)
-	if prevErrCount != totalErrCount {
-		endpoint.weight = newWeight
-		hasChanged = true
+	// every errThreshold errors (successes) decrease (increase) the weight by one step
+	prevErrCount := weightToErrorCountWithMax(state.weight, maxErrCount)
+	totalErrCount := prevErrCount + int(errCount/float64(errThreshold))*errThreshold
+	if totalErrCount < 0 {
+		totalErrCount = 0
+	}
+	if totalErrCount > maxErrCount {
+		totalErrCount = maxErrCount
+	}
+	if totalErrCount == prevErrCount {
+		return result
 	}
 
 	// reset the buffer
-	if hasChanged {
-		endpoint.data = make([]*Sample, endpoint.size, endpoint.size)
-		endpoint.position = 0
+	result.ResetSamples = true
+	result.Weight = 1 - 1/float32(maxErrCount)*float32(totalErrCount)
+	result.State = simplePolicyState{weight: result.Weight}
+	result.Explanation = describeSamples(endpoint)
+	if result.Weight <= 0.0 {
+		result.Status = EndpointStatusReasonTooManyErrors
+		result.Reason = EndpointStatusReasonTooManyErrors
+	} else {
+		result.Status = ""
+		result.Reason = SimplePolicyReasonErrorCountChanged
 	}
 
-	if endpoint.weight <= 0.0 && endpoint.status != EndpointStatusReasonTooManyErrors {
-		endpoint.status = EndpointStatusReasonTooManyErrors
-		hasChanged = true
-	} else if endpoint.status != "" {
-		endpoint.status = ""
-		hasChanged = true
-	}
+	return result
+}
 
-	return hasChanged
+// simplePolicyState holds the weight decided by the simple policy, the weight represents the number of errors observed so far
+type simplePolicyState struct {
+	weight float32
 }
 
 func weightToErrorCount(weight float32) int {
-	return 100 - int(weight*100)
+	return weightToErrorCountWithMax(weight, DefaultSimplePolicyConfig.MaxErrors)
+}
+
+// weightToErrorCountWithMax returns the number of errors the given weight represents when maxErrCount errors bring the weight to 0
+func weightToErrorCountWithMax(weight float32, maxErrCount int) int {
+	return maxErrCount - int(weight*float32(maxErrCount))
 }
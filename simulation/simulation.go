@@ -0,0 +1,180 @@
+// Package simulation provides a deterministic harness for testing the failure detector and its policies end-to-end.
+//
+// A Scenario describes the endpoints of a Service and a sequence of steps, for example:
+//
+//	simulation.Scenario{
+//		Namespace: "ns",
+//		Service:   "etcd",
+//		Endpoints: []string{"a", "b"},
+//		Steps: []simulation.Step{
+//			// endpoint "a" fails all requests for 2s while "b" doesn't fail at all,
+//			// with the default policy every 10 errors decrease the weight by 0.1
+//			simulation.Traffic{Duration: 2 * time.Second, RequestsPerSecond: 10, ErrorRates: map[string]float64{"a": 1}},
+//			simulation.Expect{Endpoint: "a", Healthy: true, Weight: 0.8},
+//			simulation.Expect{Endpoint: "b", Healthy: true, Weight: 1},
+//		},
+//	}
+//
+// The simulation drives a detector with a fake clock and processes samples synchronously,
+// errors are spread evenly over time rather than randomly, which makes the results repeatable
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	failuredetector "github.com/p0lyn0mial/failure-detector"
+)
+
+// Scenario describes the endpoints of a Service and the steps executed against a detector
+type Scenario struct {
+	Namespace string
+	Service   string
+
+	// Endpoints holds the hosts of the Service's endpoints, they are turned into https URLs
+	Endpoints []string
+
+	Steps []Step
+
+	// Options are passed to the detector created for the scenario
+	Options []failuredetector.Option
+}
+
+// Step is a single instruction of a scenario
+type Step interface {
+	run(s *Simulation) error
+}
+
+// Simulation holds the state of a running scenario
+type Simulation struct {
+	scenario Scenario
+	detector Detector
+	clock    *clock.FakeClock
+
+	// errorDebt holds per endpoint the fraction of a failed request that hasn't been issued yet,
+	// that way errors are spread evenly across requests
+	errorDebt map[string]float64
+}
+
+// Detector is the subset of the detector's API used by the simulation
+type Detector interface {
+	Record(endpointSample *failuredetector.EndpointSample) bool
+	ProcessPending()
+	EndpointStatus(namespace, service string, url *url.URL) (isHealthy bool, weight float32)
+}
+
+// Run executes the given scenario against a new detector and returns an error describing the first failed step
+func Run(scenario Scenario) error {
+	_, err := New(scenario).Run()
+	return err
+}
+
+// New creates a simulation of the given scenario, the detector uses a fake clock that starts at the Unix epoch
+func New(scenario Scenario) *Simulation {
+	fakeClock := clock.NewFakeClock(time.Unix(0, 0).UTC())
+	options := append([]failuredetector.Option{failuredetector.WithClock(fakeClock)}, scenario.Options...)
+	return &Simulation{
+		scenario:  scenario,
+		detector:  failuredetector.NewDefaultFailureDetector(options...),
+		clock:     fakeClock,
+		errorDebt: map[string]float64{},
+	}
+}
+
+// Run executes all steps of the scenario, it returns the detector for further inspection and an error describing the first failed step
+func (s *Simulation) Run() (Detector, error) {
+	for i, step := range s.scenario.Steps {
+		if err := step.run(s); err != nil {
+			return s.detector, fmt.Errorf("step %d (%T) at %v: %v", i, step, s.clock.Since(time.Unix(0, 0)), err)
+		}
+	}
+	return s.detector, nil
+}
+
+// Now returns the simulated time
+func (s *Simulation) Now() time.Time {
+	return s.clock.Now()
+}
+
+func (s *Simulation) endpointURL(endpoint string) *url.URL {
+	return &url.URL{Scheme: "https", Host: endpoint}
+}
+
+// Traffic sends requests to every endpoint of the Service for the given duration.
+// Requests are spread evenly in time, all endpoints receive the same number of requests
+type Traffic struct {
+	Duration          time.Duration
+	RequestsPerSecond int
+
+	// ErrorRates holds the fraction of requests that fail per endpoint, endpoints that are not listed don't fail
+	ErrorRates map[string]float64
+
+	// Endpoints limits the traffic to the given endpoints, all endpoints of the Service receive traffic when empty
+	Endpoints []string
+}
+
+func (t Traffic) run(s *Simulation) error {
+	if t.RequestsPerSecond <= 0 {
+		return fmt.Errorf("RequestsPerSecond must be positive")
+	}
+	endpoints := t.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = s.scenario.Endpoints
+	}
+
+	interval := time.Second / time.Duration(t.RequestsPerSecond)
+	requests := int(t.Duration / interval)
+	for i := 0; i < requests; i++ {
+		s.clock.Step(interval)
+		for _, endpoint := range endpoints {
+			var err error
+			s.errorDebt[endpoint] += t.ErrorRates[endpoint]
+			if s.errorDebt[endpoint] >= 1 {
+				s.errorDebt[endpoint]--
+				err = fmt.Errorf("simulated error")
+			}
+			s.detector.Record(&failuredetector.EndpointSample{Namespace: s.scenario.Namespace, Service: s.scenario.Service, URL: s.endpointURL(endpoint), Err: err})
+		}
+		s.detector.ProcessPending()
+	}
+	return nil
+}
+
+// Wait advances the simulated time without sending any traffic
+type Wait struct {
+	Duration time.Duration
+}
+
+func (w Wait) run(s *Simulation) error {
+	s.clock.Step(w.Duration)
+	return nil
+}
+
+// weightTolerance is the maximum difference between the expected and the actual weight
+const weightTolerance = 0.001
+
+// Expect verifies the status of an endpoint
+type Expect struct {
+	Endpoint string
+	Healthy  bool
+	Weight   float32
+}
+
+func (e Expect) run(s *Simulation) error {
+	isHealthy, weight := s.detector.EndpointStatus(s.scenario.Namespace, s.scenario.Service, s.endpointURL(e.Endpoint))
+	if isHealthy != e.Healthy || math.Abs(float64(weight-e.Weight)) > weightTolerance {
+		return fmt.Errorf("expected endpoint %q to have isHealthy = %v, weight = %v, got isHealthy = %v, weight = %v", e.Endpoint, e.Healthy, e.Weight, isHealthy, weight)
+	}
+	return nil
+}
+
+// Func runs arbitrary code against the simulation, for example to change the configuration of the detector
+type Func func(s *Simulation) error
+
+func (f Func) run(s *Simulation) error {
+	return f(s)
+}
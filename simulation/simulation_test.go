@@ -0,0 +1,84 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios := []struct {
+		scenario      Scenario
+		expectedError string
+	}{
+		{
+			scenario: Scenario{
+				Namespace: "ns",
+				Service:   "etcd",
+				Endpoints: []string{"a", "b"},
+				Steps: []Step{
+					// 30% errors cancel out with 70% successes, 10 samples never sum up to 10 errors
+					Traffic{Duration: 10 * time.Second, RequestsPerSecond: 10, ErrorRates: map[string]float64{"a": 0.3}},
+					Expect{Endpoint: "a", Healthy: true, Weight: 1},
+					Expect{Endpoint: "b", Healthy: true, Weight: 1},
+				},
+			},
+		},
+		{
+			scenario: Scenario{
+				Namespace: "ns",
+				Service:   "etcd",
+				Endpoints: []string{"a", "b"},
+				Steps: []Step{
+					// an outage of "a" drains it completely
+					Traffic{Duration: 10 * time.Second, RequestsPerSecond: 10, ErrorRates: map[string]float64{"a": 1}},
+					Expect{Endpoint: "a", Healthy: false, Weight: 0},
+					Expect{Endpoint: "b", Healthy: true, Weight: 1},
+
+					// a second of successes restores some weight
+					Traffic{Duration: time.Second, RequestsPerSecond: 10},
+					Expect{Endpoint: "a", Healthy: true, Weight: 0.1},
+
+					// and a few more seconds restore it completely
+					Traffic{Duration: 9 * time.Second, RequestsPerSecond: 10},
+					Expect{Endpoint: "a", Healthy: true, Weight: 1},
+				},
+			},
+		},
+		{
+			scenario: Scenario{
+				Namespace: "ns",
+				Service:   "etcd",
+				Endpoints: []string{"a", "b"},
+				Steps: []Step{
+					// the example from the package doc
+					Traffic{Duration: 2 * time.Second, RequestsPerSecond: 10, ErrorRates: map[string]float64{"a": 1}},
+					Expect{Endpoint: "a", Healthy: true, Weight: 0.8},
+					Expect{Endpoint: "b", Healthy: true, Weight: 1},
+				},
+			},
+		},
+		{
+			scenario: Scenario{
+				Namespace: "ns",
+				Service:   "etcd",
+				Endpoints: []string{"a"},
+				Steps: []Step{
+					Traffic{Duration: 2 * time.Second, RequestsPerSecond: 10, ErrorRates: map[string]float64{"a": 1}},
+					Expect{Endpoint: "a", Healthy: true, Weight: 0.5},
+				},
+			},
+			expectedError: `step 1 (simulation.Expect) at 2s: expected endpoint "a" to have isHealthy = true, weight = 0.5, got isHealthy = true, weight = 0.8`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		err := Run(scenario.scenario)
+		if len(scenario.expectedError) == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if len(scenario.expectedError) > 0 && (err == nil || !strings.Contains(err.Error(), scenario.expectedError)) {
+			t.Fatalf("expected %q error, got %v", scenario.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package failure_detector
+
+import (
+	"net/url"
+	"sync/atomic"
+)
+
+// serviceName identifies a Service
+type serviceName struct {
+	namespace string
+	service   string
+}
+
+// serviceSnapshot is an immutable copy of the endpoints of a single Service, it is safe for concurrent (read) access
+type serviceSnapshot struct {
+	// endpoints holds copies of WeightedEndpointStatus (without samples) under endpoint keys
+	endpoints map[string]*WeightedEndpointStatus
+}
+
+// publishedService holds the most recently published snapshot of a single Service,
+// the snapshot is replaced in place so that publishing a change doesn't copy other Services
+type publishedService struct {
+	snapshot atomic.Pointer[serviceSnapshot]
+}
+
+// storeSnapshot maps Services to their published snapshots, it is safe for concurrent (read) access.
+// The map is never modified in place, it is copied only when a Service is added or removed
+type storeSnapshot struct {
+	services map[serviceName]*publishedService
+}
+
+// service returns the snapshot of the given Service or nil if no data has been exported for it
+func (s *storeSnapshot) service(namespace, service string) *serviceSnapshot {
+	if s == nil {
+		return nil
+	}
+	published := s.services[serviceName{namespace: namespace, service: service}]
+	if published == nil {
+		return nil
+	}
+	return published.snapshot.Load()
+}
+
+// newServiceSnapshot copies the status of the given endpoints, samples are not copied as readers don't need them
+func newServiceSnapshot(endpoints []*WeightedEndpointStatus) *serviceSnapshot {
+	snapshot := &serviceSnapshot{endpoints: make(map[string]*WeightedEndpointStatus, len(endpoints))}
+	for _, weightedEndpointStatus := range endpoints {
+		weightedEndpointStatusCopy := newWeightedEndpoint(0, weightedEndpointStatus.url)
+		weightedEndpointStatusCopy.key = weightedEndpointStatus.key
+		weightedEndpointStatusCopy.namespace = weightedEndpointStatus.namespace
+		weightedEndpointStatusCopy.service = weightedEndpointStatus.service
+		weightedEndpointStatusCopy.lastUpdate = weightedEndpointStatus.lastUpdate
+		weightedEndpointStatusCopy.weight = weightedEndpointStatus.weight
+		weightedEndpointStatusCopy.status = weightedEndpointStatus.status
+		weightedEndpointStatusCopy.lastTransition = weightedEndpointStatus.lastTransition
+		weightedEndpointStatusCopy.reason = weightedEndpointStatus.reason
+		weightedEndpointStatusCopy.message = weightedEndpointStatus.message
+		weightedEndpointStatusCopy.decisionSamples = weightedEndpointStatus.decisionSamples
+		weightedEndpointStatusCopy.decisionErrors = weightedEndpointStatus.decisionErrors
+		weightedEndpointStatusCopy.history = weightedEndpointStatus.history
+		weightedEndpointStatusCopy.latencyPercentiles, _ = weightedEndpointStatus.LatencyPercentiles()
+		snapshot.endpoints[endpointKeyFunction(weightedEndpointStatusCopy)] = weightedEndpointStatusCopy
+	}
+	return snapshot
+}
+
+// propagateChangesToReadOnlyStore publishes fresh copies of the given Services taken from fd.store.
+// Services that are no longer in the store or don't have any endpoints are removed from the snapshot.
+// A change to a known Service replaces only the snapshot of that Service, adding or removing a Service copies the map of Services.
+// Must be called with fd.lock held
+func (fd *failureDetector) propagateChangesToReadOnlyStore(changedServices ...serviceName) {
+	if len(changedServices) == 0 {
+		return
+	}
+
+	var services map[serviceName]*publishedService
+	if current := fd.readOnlyStore.Load(); current != nil {
+		services = current.services
+	}
+	copied := false
+	copyServices := func() {
+		if copied {
+			return
+		}
+		servicesCopy := make(map[serviceName]*publishedService, len(services)+1)
+		for name, published := range services {
+			servicesCopy[name] = published
+		}
+		services = servicesCopy
+		copied = true
+	}
+
+	for _, changedService := range changedServices {
+		var endpoints []*WeightedEndpointStatus
+		if epStore, ok := fd.store.Get(changedService); ok {
+			endpoints = epStore.List()
+		}
+		published := services[changedService]
+		if len(endpoints) == 0 {
+			if published == nil {
+				continue
+			}
+			copyServices()
+			delete(services, changedService)
+			// readers that still hold the previous map must not observe the removed Service
+			published.snapshot.Store(nil)
+			continue
+		}
+		if published == nil {
+			copyServices()
+			published = &publishedService{}
+			services[changedService] = published
+		}
+		published.snapshot.Store(newServiceSnapshot(endpoints))
+	}
+
+	if copied {
+		fd.readOnlyStore.Store(&storeSnapshot{services: services})
+	}
+}
+
+// ServiceView provides access to the status of the endpoints of a single Service.
+// It always reads the most recently published data, thus it can be kept and reused by callers.
+// It is safe for concurrent use and doesn't allocate
+type ServiceView struct {
+	fd   *failureDetector
+	name serviceName
+}
+
+// Lookup returns a view of the given Service, the Service doesn't have to be known to the detector yet
+func (fd *failureDetector) Lookup(namespace, service string) ServiceView {
+	return ServiceView{fd: fd, name: serviceName{namespace: namespace, service: service}}
+}
+
+// EndpointStatus returns the current status of the given endpoint, see failureDetector.EndpointStatus
+func (v ServiceView) EndpointStatus(url *url.URL) (isHealthy bool, weight float32) {
+	return v.EndpointStatusWithID(url, "")
+}
+
+// EndpointStatusWithID works like EndpointStatus for detectors that identify endpoints by EndpointSample.EndpointID
+func (v ServiceView) EndpointStatusWithID(url *url.URL, endpointID string) (isHealthy bool, weight float32) {
+	endpointKey := v.fd.endpointKeyFn(url, endpointID)
+	registeredEndpoint, _ := v.fd.registry.get(v.name.namespace, v.name.service, endpointKey)
+	if registeredEndpoint != nil && len(registeredEndpoint.conditionsReason()) > 0 {
+		return false, 0
+	}
+
+	endpoint := v.endpoint(endpointKey)
+	if endpoint == nil {
+		// we haven't collected any data for this endpoint
+		// consider the endpoint healthy
+		return true, 1.0
+	}
+
+	return len(endpoint.status) == 0, endpoint.weight
+}
+
+// EndpointHealth returns the current health and weight of the given endpoint, see failureDetector.EndpointHealth
+func (v ServiceView) EndpointHealth(url *url.URL) (health EndpointHealth, weight float32) {
+	return v.EndpointHealthWithID(url, "")
+}
+
+// EndpointHealthWithID works like EndpointHealth for detectors that identify endpoints by EndpointSample.EndpointID
+func (v ServiceView) EndpointHealthWithID(url *url.URL, endpointID string) (health EndpointHealth, weight float32) {
+	endpointKey := v.fd.endpointKeyFn(url, endpointID)
+	registeredEndpoint, hasService := v.fd.registry.get(v.name.namespace, v.name.service, endpointKey)
+	if hasService && registeredEndpoint == nil {
+		return EndpointUnknown, 1.0
+	}
+	if registeredEndpoint != nil && len(registeredEndpoint.conditionsReason()) > 0 {
+		return EndpointUnhealthy, 0
+	}
+
+	endpoint := v.endpoint(endpointKey)
+	if endpoint == nil {
+		return EndpointUnknown, 1.0
+	}
+	if len(endpoint.status) > 0 {
+		return EndpointUnhealthy, endpoint.weight
+	}
+	return EndpointHealthy, endpoint.weight
+}
+
+// endpoint returns the last published copy of the given endpoint or nil if no data has been exported for it
+func (v ServiceView) endpoint(endpointKey string) *WeightedEndpointStatus {
+	serviceSnapshot := v.fd.readOnlyStore.Load().service(v.name.namespace, v.name.service)
+	if serviceSnapshot == nil {
+		// we haven't collected any data for this Service
+		return nil
+	}
+
+	return serviceSnapshot.endpoints[endpointKey]
+}
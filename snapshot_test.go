@@ -0,0 +1,97 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestPropagateChangesToReadOnlyStore(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	target := NewDefaultFailureDetector()
+	for i := 0; i < 100; i++ {
+		failingSample := &EndpointSample{Namespace: "ns", Service: fmt.Sprintf("svc-%d", i), URL: endpoint, Err: fmt.Errorf("error")}
+		for j := 0; j < 10; j++ {
+			target.processBatch([]*EndpointSample{failingSample})
+		}
+	}
+	before := target.readOnlyStore.Load()
+	snapshotsBefore := map[string]*serviceSnapshot{}
+	for i := 0; i < 100; i++ {
+		service := fmt.Sprintf("svc-%d", i)
+		snapshotsBefore[service] = before.service("ns", service)
+	}
+
+	// a change to a known Service must only replace the snapshot of that Service
+	changedSample := &EndpointSample{Namespace: "ns", Service: "svc-0", URL: endpoint, Err: fmt.Errorf("error")}
+	for j := 0; j < 10; j++ {
+		target.processBatch([]*EndpointSample{changedSample})
+	}
+	after := target.readOnlyStore.Load()
+	if after != before {
+		t.Fatal("expected the map of Services to be shared when a known Service changes")
+	}
+	for i := 0; i < 100; i++ {
+		service := fmt.Sprintf("svc-%d", i)
+		if service == "svc-0" {
+			if snapshotsBefore[service] == after.service("ns", service) {
+				t.Fatalf("expected a new snapshot for the changed Service %q", service)
+			}
+			continue
+		}
+		if snapshotsBefore[service] != after.service("ns", service) {
+			t.Fatalf("expected the snapshot of the untouched Service %q to be shared", service)
+		}
+	}
+
+	if _, weight := target.EndpointStatus("ns", "svc-0", endpoint); weight >= snapshotsBefore["svc-0"].endpoints[endpoint.Host].weight {
+		t.Fatalf("unexpected weight %v of the changed Service", weight)
+	}
+	if _, weight := target.EndpointStatus("ns", "svc-1", endpoint); weight != snapshotsBefore["svc-1"].endpoints[endpoint.Host].weight {
+		t.Fatalf("unexpected weight %v of the untouched Service", weight)
+	}
+
+	// removing a Service deletes it from a new map, the previous map doesn't expose it either
+	target.RemoveService("ns", "svc-1")
+	if current := target.readOnlyStore.Load(); current == after || current.service("ns", "svc-1") != nil {
+		t.Fatal("expected the removed Service to be deleted from a new map of Services")
+	}
+	if after.service("ns", "svc-1") != nil {
+		t.Fatal("expected the removed Service to be cleared in the previous map of Services")
+	}
+}
+
+func TestEndpointStatusDoesNotAllocate(t *testing.T) {
+	samples := benchmarkSamples(10, 5, 50)
+	target := benchmarkDetector(samples)
+	target.SetEndpoints("ns-1", "svc-1", []*url.URL{samples[1].URL})
+	unknownEndpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	view := target.Lookup("ns-1", "svc-1")
+
+	// the lookups below must find the published endpoints rather than take the path for missing data
+	for _, endpointSample := range samples[:3] {
+		if target.Lookup(endpointSample.Namespace, endpointSample.Service).endpoint(HostEndpointKey(endpointSample.URL, "")) == nil {
+			t.Fatalf("expected %s/%s %s to be published", endpointSample.Namespace, endpointSample.Service, endpointSample.URL.Host)
+		}
+	}
+
+	scenarios := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "EndpointStatus", fn: func() { target.EndpointStatus("ns-0", "svc-0", samples[0].URL) }},
+		{name: "EndpointStatus of an unknown Service", fn: func() { target.EndpointStatus("ns", "unknown", unknownEndpoint) }},
+		{name: "EndpointHealth", fn: func() { target.EndpointHealth("ns-1", "svc-1", unknownEndpoint) }},
+		{name: "ServiceView.EndpointStatus", fn: func() { view.EndpointStatus(samples[1].URL) }},
+		{name: "ServiceView.EndpointHealth", fn: func() { view.EndpointHealth(samples[1].URL) }},
+		{name: "Lookup", fn: func() { target.Lookup("ns-2", "svc-2").EndpointStatus(samples[2].URL) }},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if allocs := testing.AllocsPerRun(100, scenario.fn); allocs != 0 {
+				t.Fatalf("expected no allocations but got %v", allocs)
+			}
+		})
+	}
+}
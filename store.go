@@ -0,0 +1,123 @@
+package failure_detector
+
+import (
+	"container/list"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Store an in-memory store for entries that expire when they haven't been added (updated) within the configured TTL.
+// Expired entries are skipped by Get, List and Keys but they are removed only by RemoveExpired and Delete,
+// so that reads never change the number of entries held by the store (see Len).
+// Entries are kept in the order in which they were last added so that the least recently updated one can be found with Oldest.
+//
+// It is not safe for concurrent use, the failure detector serializes access with its lock
+type Store[K comparable, V any] struct {
+	// ttl a non-positive value disables expiration
+	ttl   time.Duration
+	clock clock.PassiveClock
+
+	// entries holds *list.Element with storeEntry under keys
+	entries map[K]*list.Element
+
+	// order holds storeEntry from the most to the least recently added
+	order *list.List
+}
+
+// storeEntry holds a value along with the time it was added at
+type storeEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	addedAt time.Time
+}
+
+// NewStore creates a new store that removes entries ttl after they were last added, the age of entries is measured by the given clock
+func NewStore[K comparable, V any](ttl time.Duration, clock clock.PassiveClock) *Store[K, V] {
+	return &Store[K, V]{ttl: ttl, clock: clock, entries: map[K]*list.Element{}, order: list.New()}
+}
+
+// Add adds the given value to the store under the given key, it replaces the previous value and resets its TTL
+func (s *Store[K, V]) Add(key K, value V) {
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*storeEntry[K, V])
+		entry.value, entry.addedAt = value, s.clock.Now()
+		s.order.MoveToFront(element)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&storeEntry[K, V]{key: key, value: value, addedAt: s.clock.Now()})
+}
+
+// Get retrieves a value from the store under the given key, the second value is false if the key is missing or has expired
+func (s *Store[K, V]) Get(key K) (V, bool) {
+	element, ok := s.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := element.Value.(*storeEntry[K, V])
+	if s.expired(entry) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// List returns all values in the store that haven't expired, from the most to the least recently added
+func (s *Store[K, V]) List() []V {
+	values := make([]V, 0, len(s.entries))
+	for element := s.order.Front(); element != nil && !s.expired(element.Value.(*storeEntry[K, V])); element = element.Next() {
+		values = append(values, element.Value.(*storeEntry[K, V]).value)
+	}
+	return values
+}
+
+// Delete removes the value stored under the given key, if any
+func (s *Store[K, V]) Delete(key K) {
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+}
+
+// Keys returns the keys of all values in the store that haven't expired, from the most to the least recently added
+func (s *Store[K, V]) Keys() []K {
+	keys := make([]K, 0, len(s.entries))
+	for element := s.order.Front(); element != nil && !s.expired(element.Value.(*storeEntry[K, V])); element = element.Next() {
+		keys = append(keys, element.Value.(*storeEntry[K, V]).key)
+	}
+	return keys
+}
+
+// Oldest returns the least recently added value along with its key without removing it,
+// the last value is false if the store is empty
+func (s *Store[K, V]) Oldest() (K, V, bool) {
+	element := s.order.Back()
+	if element == nil {
+		var zeroKey K
+		var zeroValue V
+		return zeroKey, zeroValue, false
+	}
+	entry := element.Value.(*storeEntry[K, V])
+	return entry.key, entry.value, true
+}
+
+// Len returns the number of entries in the store, including the ones that have expired but haven't been removed by RemoveExpired yet
+func (s *Store[K, V]) Len() int {
+	return len(s.entries)
+}
+
+// RemoveExpired removes expired entries, since entries are ordered by the time they were added it stops at the first entry that hasn't expired
+func (s *Store[K, V]) RemoveExpired() {
+	for element := s.order.Back(); element != nil && s.expired(element.Value.(*storeEntry[K, V])); element = s.order.Back() {
+		s.remove(element)
+	}
+}
+
+func (s *Store[K, V]) remove(element *list.Element) {
+	delete(s.entries, element.Value.(*storeEntry[K, V]).key)
+	s.order.Remove(element)
+}
+
+func (s *Store[K, V]) expired(entry *storeEntry[K, V]) bool {
+	return s.ttl > 0 && s.clock.Since(entry.addedAt) > s.ttl
+}
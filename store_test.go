@@ -0,0 +1,134 @@
+package failure_detector
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestStore(t *testing.T) {
+	type step struct {
+		advance     time.Duration
+		add         map[string]int
+		remove      []string
+		expectedGet map[string]int
+	}
+	scenarios := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "values are retrieved before they expire",
+			steps: []step{
+				{add: map[string]int{"a": 1, "b": 2}, expectedGet: map[string]int{"a": 1, "b": 2}},
+				{advance: time.Minute, expectedGet: map[string]int{"a": 1, "b": 2}},
+			},
+		},
+		{
+			name: "values expire after the TTL",
+			steps: []step{
+				{add: map[string]int{"a": 1, "b": 2}},
+				{advance: time.Minute + time.Second, expectedGet: map[string]int{}},
+			},
+		},
+		{
+			name: "adding a value resets its TTL",
+			steps: []step{
+				{add: map[string]int{"a": 1, "b": 2}},
+				{advance: 30 * time.Second, add: map[string]int{"a": 3}},
+				{advance: 31 * time.Second, expectedGet: map[string]int{"a": 3}},
+			},
+		},
+		{
+			name: "deleted values are gone",
+			steps: []step{
+				{add: map[string]int{"a": 1, "b": 2}, remove: []string{"a", "c"}, expectedGet: map[string]int{"b": 2}},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock(time.Now())
+			target := NewStore[string, int](time.Minute, fakeClock)
+			keys := map[string]bool{}
+
+			for i, step := range scenario.steps {
+				fakeClock.Step(step.advance)
+				for key, value := range step.add {
+					keys[key] = true
+					target.Add(key, value)
+				}
+				for _, key := range step.remove {
+					target.Delete(key)
+				}
+				if step.expectedGet == nil {
+					continue
+				}
+
+				held := target.Len()
+				expectedList := []int{}
+				for key := range keys {
+					value, ok := target.Get(key)
+					expectedValue, expected := step.expectedGet[key]
+					if ok != expected || value != expectedValue {
+						t.Fatalf("step %d: expected (%v, %v) for %q but got (%v, %v)", i, expectedValue, expected, key, value, ok)
+					}
+					if expected {
+						expectedList = append(expectedList, expectedValue)
+					}
+				}
+				actualList := target.List()
+				sort.Ints(actualList)
+				sort.Ints(expectedList)
+				if !reflect.DeepEqual(actualList, expectedList) {
+					t.Fatalf("step %d: expected %v values but got %v", i, expectedList, actualList)
+				}
+				if actualKeys := target.Keys(); len(actualKeys) != len(expectedList) {
+					t.Fatalf("step %d: expected %d keys but got %v", i, len(expectedList), actualKeys)
+				}
+				if target.Len() != held {
+					t.Fatalf("step %d: expected reads not to remove values but the store holds %d instead of %d values", i, target.Len(), held)
+				}
+				target.RemoveExpired()
+				if target.Len() != len(expectedList) {
+					t.Fatalf("step %d: expected expired values to be removed but the store holds %d values", i, target.Len())
+				}
+			}
+		})
+	}
+}
+
+func TestStoreOrder(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	target := NewStore[string, int](time.Minute, fakeClock)
+	if _, _, ok := target.Oldest(); ok {
+		t.Fatal("expected an empty store not to have the oldest value")
+	}
+
+	target.Add("a", 1)
+	target.Add("b", 2)
+	target.Add("c", 3)
+	target.Add("a", 4)
+	if keys := target.Keys(); !reflect.DeepEqual(keys, []string{"a", "c", "b"}) {
+		t.Fatalf("expected keys from the most to the least recently added but got %v", keys)
+	}
+	if key, value, _ := target.Oldest(); key != "b" || value != 2 {
+		t.Fatalf("expected b=2 to be the oldest value but got %s=%d", key, value)
+	}
+	target.Delete("b")
+	if key, _, _ := target.Oldest(); key != "c" {
+		t.Fatalf("expected c to be the oldest value but got %s", key)
+	}
+
+	// a non-positive TTL disables expiration
+	target = NewStore[string, int](0, fakeClock)
+	target.Add("a", 1)
+	fakeClock.Step(24 * time.Hour)
+	if _, ok := target.Get("a"); !ok {
+		t.Fatal("expected the value not to expire")
+	}
+}
@@ -1,44 +1,64 @@
 package failure_detector
 
 import (
-	"context"
 	"fmt"
-	"math/rand"
 	"net/url"
 	"testing"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
 )
 
 func TestDriveFailureDetector(t *testing.T) {
-	rand.Seed(time.Now().UnixNano())
-
-	target := NewDefaultFailureDetector()
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	target := NewDefaultFailureDetector(WithClock(fakeClock))
 	collectorCh := target.Collector()
 
-	go target.Run(context.TODO())
-	for i := 0; i < 100000; i++ {
-		collectorCh <- generateRandomItem()
+	// endpoint 0 always fails, endpoint 1 fails every other request and endpoint 2 never fails
+	for round := 0; round < 200; round++ {
+		for namespace := 0; namespace < 10; namespace++ {
+			for endpoint := 0; endpoint < 3; endpoint++ {
+				var err error
+				if endpoint == 0 || (endpoint == 1 && round%2 == 0) {
+					err = fmt.Errorf("nasty error")
+				}
+				collectorCh <- generateItem(namespace, endpoint, err)
+			}
+		}
+		target.ProcessPending()
+		fakeClock.Step(100 * time.Millisecond)
+	}
+
+	scenarios := []struct {
+		endpoint          int
+		expectedIsHealthy bool
+		expectedWeight    float32
+	}{
+		{endpoint: 0, expectedIsHealthy: false, expectedWeight: 0},
+		{endpoint: 1, expectedIsHealthy: true, expectedWeight: 1},
+		{endpoint: 2, expectedIsHealthy: true, expectedWeight: 1},
+	}
+	for namespace := 0; namespace < 10; namespace++ {
+		for _, scenario := range scenarios {
+			sample := generateItem(namespace, scenario.endpoint, nil)
+			isHealthy, weight := target.EndpointStatus(sample.Namespace, sample.Service, sample.URL)
+			if isHealthy != scenario.expectedIsHealthy || weightToErrorCount(weight) != weightToErrorCount(scenario.expectedWeight) {
+				t.Fatalf("expected endpoint (%s/%s/%s) status isHealthy = %v, weight = %v, got isHealthy = %v, weight = %v",
+					sample.Namespace, sample.Service, sample.URL.Host, scenario.expectedIsHealthy, scenario.expectedWeight, isHealthy, weight)
+			}
+		}
 	}
-	time.Sleep(2 * time.Second)
-	generatedSample := generateRandomItem()
 
-	isHealthy, weight := target.EndpointStatus(generatedSample.Namespace, generatedSample.Service, generatedSample.URL)
-	fmt.Println(fmt.Sprintf("endpoint (%s/%s/%s) status isHealthy = %v, weight = %v", generatedSample.Namespace, generatedSample.Service, generatedSample.URL.Host, isHealthy, weight))
 }
 
-func generateRandomItem() *EndpointSample {
-	var err error
-	if rand.Intn(2) == 1 {
-		err = fmt.Errorf("nasty error")
-	}
+func generateItem(namespace, endpoint int, err error) *EndpointSample {
 	return &EndpointSample{
-		fmt.Sprintf("%d", rand.Intn(10)),
-		"etcd",
-		&url.URL{
+		Namespace: fmt.Sprintf("%d", namespace),
+		Service:   "etcd",
+		URL: &url.URL{
 			Scheme: "https",
-			Host:   fmt.Sprintf("1.1.1.%d:6443", rand.Intn(3)),
+			Host:   fmt.Sprintf("1.1.1.%d:6443", endpoint),
 		},
-		err,
+		Err: err,
 	}
 }
-
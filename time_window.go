@@ -0,0 +1,147 @@
+package failure_detector
+
+import "time"
+
+// WithTimeWindow makes endpoints keep counters of the samples collected within the given window split into buckets of the given size
+// instead of a fixed number of the most recent samples (see WithWindowSize), for example the last 30s in 1s buckets.
+// Samples older than the window don't affect the status of an endpoint and the memory used per endpoint doesn't depend on the number of samples.
+// Individual samples aren't kept (WeightedEndpointStatus.Get returns nothing), policies read the counters via WeightedEndpointStatus.WindowCounts.
+// Note that the counters aren't persisted by WithCheckpoint
+func WithTimeWindow(window, bucket time.Duration) Option {
+	return func(fd *failureDetector) {
+		if window > 0 && bucket > 0 {
+			fd.timeWindow = window
+			fd.timeWindowBucket = bucket
+		}
+	}
+}
+
+// WindowCounts summarizes the samples collected within the time window of an endpoint
+type WindowCounts struct {
+	// Window the length of the window, it is a multiple of the bucket size
+	Window time.Duration
+
+	// Samples the number of collected samples
+	Samples int
+
+	// Requests the number of requests the samples stand for, samples that survived thinning (see SetSamplingRate) stand for more than one request
+	Requests float64
+
+	// Errors the number of requests that failed
+	Errors float64
+}
+
+// ErrorRate returns the fraction of requests that failed, it is 0 when no requests have been collected
+func (c WindowCounts) ErrorRate() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return c.Errors / c.Requests
+}
+
+// RequestRate returns the number of requests per second
+func (c WindowCounts) RequestRate() float64 {
+	if c.Window <= 0 {
+		return 0
+	}
+	return c.Requests / c.Window.Seconds()
+}
+
+// sampleBucket holds the counters of the samples collected within a single bucket of a timeWindow
+type sampleBucket struct {
+	samples  int
+	requests float64
+	errors   float64
+}
+
+// timeWindow counts samples in a ring of fixed-size buckets, the head bucket covers the most recent sample.
+// Buckets are reused as the window moves forward thus the memory doesn't depend on the number of samples
+type timeWindow struct {
+	bucketSize time.Duration
+	buckets    []sampleBucket
+	head       int
+
+	// latest is the beginning of the head bucket, zero means no samples have been collected yet
+	latest time.Time
+
+	// lastErr is the most recent error observed within the window along with the time it was observed
+	lastErr     error
+	lastErrTime time.Time
+}
+
+func newTimeWindow(window, bucketSize time.Duration) *timeWindow {
+	return &timeWindow{bucketSize: bucketSize, buckets: make([]sampleBucket, timeWindowBuckets(window, bucketSize))}
+}
+
+// timeWindowBuckets returns the number of buckets of the given size that cover the given window, the window is rounded down to a multiple of the bucket size
+func timeWindowBuckets(window, bucketSize time.Duration) int {
+	if buckets := int(window / bucketSize); buckets > 1 {
+		return buckets
+	}
+	return 1
+}
+
+// window returns the length of the window
+func (w *timeWindow) window() time.Duration {
+	return time.Duration(len(w.buckets)) * w.bucketSize
+}
+
+// add counts the given sample in the bucket that covers its timestamp,
+// a sample newer than the head bucket moves the window forward, a sample older than the window is ignored
+func (w *timeWindow) add(sample *Sample) {
+	start := sample.timestamp.Truncate(w.bucketSize)
+	if w.latest.IsZero() || start.After(w.latest) {
+		w.advance(start)
+	}
+
+	offset := int(w.latest.Sub(start) / w.bucketSize)
+	if offset >= len(w.buckets) {
+		return
+	}
+	bucket := &w.buckets[(w.head-offset+len(w.buckets))%len(w.buckets)]
+	bucket.samples++
+	bucket.requests += sample.requestCount()
+	if sample.err != nil {
+		bucket.errors += sample.requestCount()
+		if w.lastErr == nil || !sample.timestamp.Before(w.lastErrTime) {
+			w.lastErr, w.lastErrTime = sample.err, sample.timestamp
+		}
+	}
+}
+
+// advance moves the head to the bucket that begins at the given time clearing the buckets that fell out of the window
+func (w *timeWindow) advance(start time.Time) {
+	steps := len(w.buckets)
+	if !w.latest.IsZero() {
+		if distance := start.Sub(w.latest) / w.bucketSize; distance < time.Duration(steps) {
+			steps = int(distance)
+		}
+	}
+	for i := 0; i < steps; i++ {
+		w.head = (w.head + 1) % len(w.buckets)
+		w.buckets[w.head] = sampleBucket{}
+	}
+	w.latest = start
+	if w.lastErr != nil && !w.lastErrTime.Truncate(w.bucketSize).After(start.Add(-w.window())) {
+		w.lastErr, w.lastErrTime = nil, time.Time{}
+	}
+}
+
+// counts sums the counters of all buckets
+func (w *timeWindow) counts() WindowCounts {
+	counts := WindowCounts{Window: w.window()}
+	for _, bucket := range w.buckets {
+		counts.Samples += bucket.samples
+		counts.Requests += bucket.requests
+		counts.Errors += bucket.errors
+	}
+	return counts
+}
+
+// reset clears all counters, the position of the window is kept
+func (w *timeWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = sampleBucket{}
+	}
+	w.lastErr, w.lastErrTime = nil, time.Time{}
+}
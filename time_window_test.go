@@ -0,0 +1,173 @@
+package failure_detector
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestTimeWindow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampleAt := func(offset time.Duration, failed bool) *Sample {
+		sample := &Sample{timestamp: now.Add(offset)}
+		if failed {
+			sample.err = fmt.Errorf("error at %v", offset)
+		}
+		return sample
+	}
+
+	target := newTimeWindow(3*time.Second, time.Second)
+	steps := []struct {
+		name              string
+		samples           []*Sample
+		expectedCounts    WindowCounts
+		expectedLastErr   string
+		expectedErrorRate float64
+	}{
+		{
+			name:            "samples within the window",
+			samples:         []*Sample{sampleAt(0, false), sampleAt(500*time.Millisecond, true), sampleAt(time.Second, false), sampleAt(2*time.Second, false)},
+			expectedCounts:  WindowCounts{Window: 3 * time.Second, Samples: 4, Requests: 4, Errors: 1},
+			expectedLastErr: "error at 500ms",
+		},
+		{
+			name:           "the window moves forward",
+			samples:        []*Sample{sampleAt(3*time.Second, false)},
+			expectedCounts: WindowCounts{Window: 3 * time.Second, Samples: 3, Requests: 3},
+		},
+		{
+			name:            "a late sample within the window is counted",
+			samples:         []*Sample{sampleAt(1500*time.Millisecond, true)},
+			expectedCounts:  WindowCounts{Window: 3 * time.Second, Samples: 4, Requests: 4, Errors: 1},
+			expectedLastErr: "error at 1.5s",
+		},
+		{
+			name:            "a sample older than the window is ignored",
+			samples:         []*Sample{sampleAt(900*time.Millisecond, true)},
+			expectedCounts:  WindowCounts{Window: 3 * time.Second, Samples: 4, Requests: 4, Errors: 1},
+			expectedLastErr: "error at 1.5s",
+		},
+		{
+			name:            "thinned samples stand for more requests",
+			samples:         []*Sample{{timestamp: now.Add(3 * time.Second), count: 4}},
+			expectedCounts:  WindowCounts{Window: 3 * time.Second, Samples: 5, Requests: 8, Errors: 1},
+			expectedLastErr: "error at 1.5s",
+		},
+		{
+			name:           "stale samples are dropped",
+			samples:        []*Sample{sampleAt(time.Hour, false)},
+			expectedCounts: WindowCounts{Window: 3 * time.Second, Samples: 1, Requests: 1},
+		},
+	}
+
+	for _, step := range steps {
+		for _, sample := range step.samples {
+			target.add(sample)
+		}
+		if actualCounts := target.counts(); actualCounts != step.expectedCounts {
+			t.Fatalf("%s: expected %+v but got %+v", step.name, step.expectedCounts, actualCounts)
+		}
+		actualLastErr := ""
+		if target.lastErr != nil {
+			actualLastErr = target.lastErr.Error()
+		}
+		if actualLastErr != step.expectedLastErr {
+			t.Fatalf("%s: expected %q last error but got %q", step.name, step.expectedLastErr, actualLastErr)
+		}
+	}
+
+	target.reset()
+	if actualCounts := target.counts(); actualCounts != (WindowCounts{Window: 3 * time.Second}) {
+		t.Fatalf("expected no samples after reset, got %+v", actualCounts)
+	}
+}
+
+func TestWindowCountsRates(t *testing.T) {
+	counts := WindowCounts{Window: 30 * time.Second, Samples: 20, Requests: 60, Errors: 15}
+	if counts.ErrorRate() != 0.25 || counts.RequestRate() != 2 {
+		t.Fatalf("expected 0.25 error rate and 2 requests per second, got %v and %v", counts.ErrorRate(), counts.RequestRate())
+	}
+	if (WindowCounts{}).ErrorRate() != 0 || (WindowCounts{}).RequestRate() != 0 {
+		t.Fatal("expected no rates without requests")
+	}
+}
+
+func TestTimeWindowedEndpoints(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name           string
+		options        []Option
+		expectedWeight float32
+	}{
+		{
+			name:           "the most recent samples include stale errors",
+			expectedWeight: weightAfterErrors(10),
+		},
+		{
+			name:           "stale errors are outside of the time window",
+			options:        []Option{WithTimeWindow(30*time.Second, time.Second)},
+			expectedWeight: 1,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock(now)
+			target := NewDefaultFailureDetector(scenario.options...)
+			target.clock = fakeClock
+
+			for _, endpointSample := range genSamples(endpoint, 5, true) {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+			// the endpoint hasn't expired yet (see WithEndpointTTL)
+			fakeClock.Step(50 * time.Second)
+			for _, endpointSample := range genSamples(endpoint, 5, true) {
+				target.processBatch([]*EndpointSample{endpointSample})
+			}
+
+			if _, weight := target.EndpointStatus("ns", "etcd", endpoint); weight != scenario.expectedWeight {
+				t.Fatalf("expected %v weight but got %v", scenario.expectedWeight, weight)
+			}
+		})
+	}
+}
+
+func TestTimeWindowPolicy(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(now)
+	target := NewDefaultFailureDetector(WithTimeWindow(10*time.Second, time.Second), WithClock(fakeClock))
+
+	// ejects endpoints that fail more than half of the requests once they serve at least a request per second
+	policy := func(endpoint *WeightedEndpointStatus) PolicyResult {
+		counts, _ := endpoint.WindowCounts()
+		if counts.RequestRate() >= 1 && counts.ErrorRate() > 0.5 {
+			return PolicyResult{Status: "HighErrorRate", Reason: "HighErrorRate", Explanation: describeSamples(endpoint)}
+		}
+		return PolicyResult{Weight: 1}
+	}
+	if err := target.SetPolicy(PolicyRule{Namespace: "ns", Service: "etcd", Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 9 failed requests in 9 seconds, with an explicit timestamp
+	for i, endpointSample := range genSamples(endpoint, 9, true) {
+		endpointSample.Timestamp = now.Add(time.Duration(i) * time.Second)
+		target.processBatch([]*EndpointSample{endpointSample})
+	}
+	if isHealthy, _ := target.EndpointStatus("ns", "etcd", endpoint); !isHealthy {
+		t.Fatal("expected a healthy endpoint below the request rate")
+	}
+
+	fakeClock.Step(9 * time.Second)
+	target.processBatch(genSamples(endpoint, 1, true))
+	details := target.EndpointStatusDetails("ns", "etcd", endpoint)
+	if expected := "Unhealthy (HighErrorRate): 10 of 10 requests in the last 10s failed: error 0"; details.String() != expected {
+		t.Fatalf("expected %q but got %q", expected, details.String())
+	}
+}
@@ -0,0 +1,122 @@
+package failure_detector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// TraceRecord is a single line of a trace file (JSON lines), it holds an EndpointSample along with the time it has been collected
+// (EndpointSample.Timestamp or the time the record has been written when the sample doesn't carry one)
+type TraceRecord struct {
+	Timestamp  time.Time `json:"ts"`
+	Namespace  string    `json:"namespace"`
+	Service    string    `json:"service"`
+	URL        string    `json:"url"`
+	EndpointID string    `json:"endpointID,omitempty"`
+	Err        string    `json:"err,omitempty"`
+	Failed     bool      `json:"failed,omitempty"`
+	Active     bool      `json:"active,omitempty"`
+
+	// Latency is expressed in nanoseconds
+	Latency time.Duration `json:"latency,omitempty"`
+
+	// SamplingRate is set for samples that survived thinning
+	SamplingRate float64 `json:"samplingRate,omitempty"`
+}
+
+// TraceWriter writes EndpointSamples to a trace file, it is safe for concurrent use
+type TraceWriter struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	clock   clock.PassiveClock
+}
+
+// NewTraceWriter creates a TraceWriter that writes records to the given writer
+// callers are responsible for buffering and flushing the writer
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{encoder: json.NewEncoder(w), clock: clock.RealClock{}}
+}
+
+// Write appends the given EndpointSample to the trace
+func (t *TraceWriter) Write(endpointSample *EndpointSample) error {
+	record := TraceRecord{
+		Timestamp:    endpointSample.Timestamp,
+		Namespace:    endpointSample.Namespace,
+		Service:      endpointSample.Service,
+		EndpointID:   endpointSample.EndpointID,
+		Failed:       endpointSample.Err != nil,
+		Active:       endpointSample.Active,
+		Latency:      endpointSample.Latency,
+		SamplingRate: endpointSample.samplingRate,
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = t.clock.Now()
+	}
+	if endpointSample.URL != nil {
+		record.URL = endpointSample.URL.String()
+	}
+	if endpointSample.Err != nil {
+		record.Err = endpointSample.Err.Error()
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.encoder.Encode(record)
+}
+
+// TraceReader reads records from a trace file
+type TraceReader struct {
+	decoder *json.Decoder
+}
+
+// NewTraceReader creates a TraceReader that reads records from the given reader
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{decoder: json.NewDecoder(r)}
+}
+
+// Next returns the next record along with the EndpointSample it holds, io.EOF is returned at the end of the trace
+func (t *TraceReader) Next() (*TraceRecord, *EndpointSample, error) {
+	record := &TraceRecord{}
+	if err := t.decoder.Decode(record); err != nil {
+		return nil, nil, err
+	}
+
+	endpointSample := &EndpointSample{
+		Namespace:    record.Namespace,
+		Service:      record.Service,
+		EndpointID:   record.EndpointID,
+		Active:       record.Active,
+		Latency:      record.Latency,
+		samplingRate: record.SamplingRate,
+	}
+	if len(record.URL) > 0 {
+		u, err := url.Parse(record.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid URL %q: %v", record.URL, err)
+		}
+		endpointSample.URL = u
+	}
+	if record.Failed {
+		endpointSample.Err = errors.New(record.Err)
+	}
+	return record, endpointSample, nil
+}
+
+// WithTraceWriter records every EndpointSample received by the detector (passed to Record or sent to Collector) to the given trace
+func WithTraceWriter(traceWriter *TraceWriter) Option {
+	return func(fd *failureDetector) {
+		fd.processor.tapFn = func(endpointSample *EndpointSample) {
+			if err := traceWriter.Write(endpointSample); err != nil {
+				utilruntime.HandleError(fmt.Errorf("failed to record a sample: %v", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package failure_detector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	samples := []*EndpointSample{
+		{Namespace: "ns", Service: "etcd", URL: endpoint, Latency: 15 * time.Millisecond},
+		{Namespace: "ns", Service: "etcd", URL: endpoint, Err: fmt.Errorf("nasty error")},
+		{Namespace: "ns", Service: "etcd", URL: endpoint, Active: true, samplingRate: 0.5},
+		{Namespace: "ns", Service: "etcd", URL: endpoint, Timestamp: now.Add(-time.Minute)},
+	}
+
+	buf := &bytes.Buffer{}
+	fakeClock := clock.NewFakeClock(now)
+	writer := NewTraceWriter(buf)
+	writer.clock = fakeClock
+	for _, endpointSample := range samples {
+		if err := writer.Write(endpointSample); err != nil {
+			t.Fatal(err)
+		}
+		fakeClock.Step(time.Second)
+	}
+
+	reader := NewTraceReader(buf)
+	for i, expected := range samples {
+		record, actual, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the time of the sample takes precedence over the time of writing
+		expectedTimestamp := now.Add(time.Duration(i) * time.Second)
+		if !expected.Timestamp.IsZero() {
+			expectedTimestamp = expected.Timestamp
+		}
+		if !record.Timestamp.Equal(expectedTimestamp) {
+			t.Fatalf("expected %v timestamp but got %v", expectedTimestamp, record.Timestamp)
+		}
+		actual.Timestamp = expected.Timestamp
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("expected %#v but got %#v", expected, actual)
+		}
+	}
+	if _, _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+
+	buf := &bytes.Buffer{}
+	fakeClock := clock.NewFakeClock(now)
+	writer := NewTraceWriter(buf)
+	writer.clock = fakeClock
+	for _, endpointSample := range append(genSamples(endpoint, 20, true), genSamples(endpoint, 10, false)...) {
+		if err := writer.Write(endpointSample); err != nil {
+			t.Fatal(err)
+		}
+		fakeClock.Step(time.Second)
+	}
+
+	actualEvents := []ReplayEvent{}
+	err := Replay(buf, SimpleWeightedEndpointStatusEvaluator, func(event ReplayEvent) {
+		actualEvents = append(actualEvents, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEvents := []ReplayEvent{
+		{Timestamp: now.Add(9 * time.Second), Namespace: "ns", Service: "etcd", Endpoint: endpoint.Host, Weight: 0.9},
+		{Timestamp: now.Add(19 * time.Second), Namespace: "ns", Service: "etcd", Endpoint: endpoint.Host, Weight: 0.8},
+		{Timestamp: now.Add(29 * time.Second), Namespace: "ns", Service: "etcd", Endpoint: endpoint.Host, Weight: 0.9},
+	}
+	if len(actualEvents) != len(expectedEvents) {
+		t.Fatalf("expected %d events but got %+v", len(expectedEvents), actualEvents)
+	}
+	for i := range expectedEvents {
+		if weightToErrorCount(actualEvents[i].Weight) != weightToErrorCount(expectedEvents[i].Weight) {
+			t.Fatalf("expected %+v event but got %+v", expectedEvents[i], actualEvents[i])
+		}
+		actualEvents[i].Weight = expectedEvents[i].Weight
+		if !reflect.DeepEqual(actualEvents[i], expectedEvents[i]) {
+			t.Fatalf("expected %+v event but got %+v", expectedEvents[i], actualEvents[i])
+		}
+	}
+}
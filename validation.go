@@ -0,0 +1,80 @@
+package failure_detector
+
+import "sync/atomic"
+
+// RejectionReason describes why an EndpointSample has been rejected
+type RejectionReason string
+
+const (
+	// RejectionReasonNilSample means a nil EndpointSample has been passed to the detector
+	RejectionReasonNilSample RejectionReason = "NilSample"
+
+	// RejectionReasonMissingNamespace means EndpointSample.Namespace is empty
+	RejectionReasonMissingNamespace RejectionReason = "MissingNamespace"
+
+	// RejectionReasonMissingService means EndpointSample.Service is empty
+	RejectionReasonMissingService RejectionReason = "MissingService"
+
+	// RejectionReasonMissingURL means EndpointSample.URL is nil
+	RejectionReasonMissingURL RejectionReason = "MissingURL"
+
+	// RejectionReasonMissingEndpointKey means the endpoint key function returned an empty key for the sample
+	RejectionReasonMissingEndpointKey RejectionReason = "MissingEndpointKey"
+)
+
+// Rejection describes an EndpointSample that has been rejected
+type Rejection struct {
+	// Sample is nil for RejectionReasonNilSample
+	Sample *EndpointSample
+	Reason RejectionReason
+}
+
+// RejectionFunc a function notified when an EndpointSample is rejected.
+// It is called synchronously by Record, the collector and the worker, it must be safe for concurrent use and must not block
+type RejectionFunc func(rejection Rejection)
+
+// WithRejectionHandler sets a function that is notified when an EndpointSample is rejected as invalid
+func WithRejectionHandler(fn RejectionFunc) Option {
+	return func(fd *failureDetector) {
+		fd.rejectionFn = fn
+	}
+}
+
+// RejectedSamples returns the number of samples rejected as invalid,
+// i.e. nil samples, samples without a namespace, a service or a URL and samples for which the endpoint key function returned an empty key
+func (fd *failureDetector) RejectedSamples() uint64 {
+	return atomic.LoadUint64(&fd.rejectedSamples)
+}
+
+// admit validates the given EndpointSample, invalid samples are reported and false is returned
+func (fd *failureDetector) admit(endpointSample *EndpointSample) bool {
+	reason := validateEndpointSample(endpointSample)
+	if len(reason) == 0 {
+		return true
+	}
+	fd.reject(endpointSample, reason)
+	return false
+}
+
+// reject counts the given EndpointSample as rejected and notifies the rejection handler
+func (fd *failureDetector) reject(endpointSample *EndpointSample, reason RejectionReason) {
+	atomic.AddUint64(&fd.rejectedSamples, 1)
+	if fd.rejectionFn != nil {
+		fd.rejectionFn(Rejection{Sample: endpointSample, Reason: reason})
+	}
+}
+
+// validateEndpointSample returns the reason the given EndpointSample is invalid or an empty string
+func validateEndpointSample(endpointSample *EndpointSample) RejectionReason {
+	switch {
+	case endpointSample == nil:
+		return RejectionReasonNilSample
+	case len(endpointSample.Namespace) == 0:
+		return RejectionReasonMissingNamespace
+	case len(endpointSample.Service) == 0:
+		return RejectionReasonMissingService
+	case endpointSample.URL == nil:
+		return RejectionReasonMissingURL
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package failure_detector
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRejectInvalidSamples(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	scenarios := []struct {
+		name            string
+		options         []Option
+		sample          *EndpointSample
+		expectedReasons []RejectionReason
+	}{
+		{
+			name:   "valid sample",
+			sample: &EndpointSample{Namespace: "ns", Service: "etcd", URL: endpoint},
+		},
+		{
+			name:            "nil sample",
+			expectedReasons: []RejectionReason{RejectionReasonNilSample},
+		},
+		{
+			name:            "missing namespace",
+			sample:          &EndpointSample{Service: "etcd", URL: endpoint},
+			expectedReasons: []RejectionReason{RejectionReasonMissingNamespace},
+		},
+		{
+			name:            "missing service",
+			sample:          &EndpointSample{Namespace: "ns", URL: endpoint},
+			expectedReasons: []RejectionReason{RejectionReasonMissingService},
+		},
+		{
+			name:            "missing URL",
+			sample:          &EndpointSample{Namespace: "ns", Service: "etcd"},
+			expectedReasons: []RejectionReason{RejectionReasonMissingURL},
+		},
+		{
+			name:            "missing endpoint key",
+			options:         []Option{WithEndpointKeyFunction(EndpointIDKey)},
+			sample:          &EndpointSample{Namespace: "ns", Service: "etcd", URL: endpoint},
+			expectedReasons: []RejectionReason{RejectionReasonMissingEndpointKey},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		for _, ingest := range []string{"Record", "Collector"} {
+			t.Run(scenario.name+" via "+ingest, func(t *testing.T) {
+				var actualReasons []RejectionReason
+				options := append([]Option{WithRejectionHandler(func(rejection Rejection) {
+					if rejection.Sample != scenario.sample {
+						t.Errorf("expected the rejected sample to be reported")
+					}
+					actualReasons = append(actualReasons, rejection.Reason)
+				})}, scenario.options...)
+				target := NewDefaultFailureDetector(options...)
+
+				if ingest == "Record" {
+					if accepted := target.Record(scenario.sample); accepted != (validateEndpointSample(scenario.sample) == "") {
+						t.Fatalf("unexpected result %v returned from Record", accepted)
+					}
+				} else {
+					target.Collector() <- scenario.sample
+				}
+				// the collector must survive invalid samples
+				target.ProcessPending()
+
+				if !reflect.DeepEqual(actualReasons, scenario.expectedReasons) {
+					t.Fatalf("expected %v rejections but got %v", scenario.expectedReasons, actualReasons)
+				}
+				if target.RejectedSamples() != uint64(len(scenario.expectedReasons)) {
+					t.Fatalf("expected %d rejected samples but got %d", len(scenario.expectedReasons), target.RejectedSamples())
+				}
+				expectedProcessed := uint64(0)
+				if validateEndpointSample(scenario.sample) == "" {
+					expectedProcessed = 1
+				}
+				if target.ProcessedSamples() != expectedProcessed {
+					t.Fatalf("expected %d processed samples but got %d", expectedProcessed, target.ProcessedSamples())
+				}
+			})
+		}
+	}
+}
+
+func TestSamplesAreValidatedOnce(t *testing.T) {
+	endpoint := &url.URL{Scheme: "https", Host: "1.1.1.1:6443"}
+	scenarios := []struct {
+		ingest              string
+		expectedValidations int
+	}{
+		// Record validates the sample before it is handed over
+		{ingest: "Record", expectedValidations: 0},
+		{ingest: "Collector", expectedValidations: 1},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.ingest, func(t *testing.T) {
+			target := NewDefaultFailureDetector()
+			validations := 0
+			target.processor.admitFn = func(endpointSample *EndpointSample) bool {
+				validations++
+				return target.admit(endpointSample)
+			}
+
+			endpointSample := &EndpointSample{Namespace: "ns", Service: "etcd", URL: endpoint}
+			if scenario.ingest == "Record" {
+				target.Record(endpointSample)
+			} else {
+				target.Collector() <- endpointSample
+			}
+			target.ProcessPending()
+
+			if validations != scenario.expectedValidations {
+				t.Fatalf("expected the collector to validate the sample %d times but got %d", scenario.expectedValidations, validations)
+			}
+			if target.ProcessedSamples() != 1 {
+				t.Fatalf("expected the sample to be processed, got %d processed samples", target.ProcessedSamples())
+			}
+		})
+	}
+}